@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveFormat picks the archive format for dest: format if given,
+// otherwise zip, tgz or tar from the file name.
+func archiveFormat(dest, format string) string {
+	switch {
+	case format != "":
+		if format == "tar.gz" {
+			return "tgz"
+		}
+		return format
+	case strings.HasSuffix(dest, ".zip"):
+		return "zip"
+	case strings.HasSuffix(dest, ".tar.gz") || strings.HasSuffix(dest, ".tgz"):
+		return "tgz"
+	}
+	return "tar"
+}
+
+// writeArchive writes the files of commitID to dest as a tar, tgz or zip
+// archive, depending on format. Paths are relative to the project root and
+// no repository metadata is included.
+func writeArchive(commitID, dest, format string) error {
+	format = archiveFormat(dest, format)
+	if format != "tar" && format != "tgz" && format != "zip" {
+		return fmt.Errorf("unknown archive format '%s'", format)
+	}
+	c, err := loadCommit(commitID)
+	if err != nil {
+		return err
+	}
+	files := snapshotFiles(commitID)
+	sort.Strings(files)
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if format == "zip" {
+		err = writeZip(out, commitID, files, c.Date)
+	} else {
+		err = writeTar(out, commitID, files, c.Date, format == "tgz")
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dest)
+	}
+	return err
+}
+
+func writeTar(w io.Writer, commitID string, files []string, mtime time.Time, compress bool) error {
+	if compress {
+		gz := gzip.NewWriter(w)
+		if err := writeTar(gz, commitID, files, mtime, false); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(".fool", "objects", commitID, f))
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: f, Mode: 0644, Size: int64(len(data)), ModTime: mtime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, commitID string, files []string, mtime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(".fool", "objects", commitID, f))
+		if err != nil {
+			return err
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f, Method: zip.Deflate, Modified: mtime})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func cmdArchive(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	format := fs.String("format", "", "archive format: tar, tgz or zip (default: from the output name)")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Println("Usage: fool archive [--format=tar|tgz|zip] <commitID> <output>")
+		return
+	}
+	commitID, err := resolveRef(fs.Arg(0))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := writeArchive(commitID, fs.Arg(1), *format); err != nil {
+		fmt.Println("Error writing archive:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s from commit %s\n", fs.Arg(1), commitID)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// blameLine is one line of a file with the commit that last changed it.
+type blameLine struct {
+	commit *CommitMeta // nil for a line that is not committed yet
+	text   string
+}
+
+// blameFile attributes each line of the working copy of path to the commit
+// that introduced it, replaying the history of HEAD oldest first. It reports
+// false if path is not in any commit.
+func blameFile(path string) ([]blameLine, bool) {
+	history := commitHistory(headCommitID())
+	var lines []blameLine
+	found := false
+	for i := len(history) - 1; i >= 0; i-- {
+		c := history[i]
+		data, err := os.ReadFile(filepath.Join(".fool", "objects", c.ID, path))
+		if err != nil {
+			// Deleted here; a later commit that re-adds it starts afresh.
+			lines = nil
+			continue
+		}
+		found = true
+		lines = blameStep(lines, splitContentLines(data), c)
+	}
+	if !found {
+		return nil, false
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		lines = blameStep(lines, splitContentLines(data), nil)
+	}
+	return lines, true
+}
+
+// blameStep carries the attribution of unchanged lines over to the next
+// version of a file and gives every added line to c.
+func blameStep(prev []blameLine, next []string, c *CommitMeta) []blameLine {
+	old := make([]string, len(prev))
+	for i, l := range prev {
+		old[i] = l.text
+	}
+	var out []blameLine
+	i := 0
+	for _, op := range diffLines(old, next) {
+		switch op.Kind {
+		case ' ':
+			out = append(out, prev[i])
+			i++
+		case '-':
+			i++
+		case '+':
+			out = append(out, blameLine{commit: c, text: op.Line})
+		}
+	}
+	return out
+}
+
+func cmdBlame(args []string) {
+	ensureRepo()
+	if len(args) != 1 {
+		fmt.Println("Usage: fool blame <file>")
+		return
+	}
+	path := filepath.ToSlash(filepath.Clean(args[0]))
+	lines, ok := blameFile(path)
+	if !ok {
+		fmt.Printf("Error: '%s' has never been committed.\n", path)
+		os.Exit(1)
+	}
+	const dateLayout = "2006-01-02 15:04:05"
+	for _, l := range lines {
+		id, date := "00000000", "Not committed yet"
+		if l.commit != nil {
+			id, date = abbrevID(l.commit.ID, defaultAbbrev), l.commit.Date.In(time.Local).Format(dateLayout)
+		}
+		fmt.Printf("%-8s %-*s %s\n", id, len(dateLayout), date, l.text)
+	}
+}
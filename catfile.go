@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// prettyCommit renders c with one aligned "<field> <value>" line per
+// recorded field, followed by the indented message.
+func prettyCommit(c *CommitMeta) string {
+	var b strings.Builder
+	field := func(name, value string) {
+		fmt.Fprintf(&b, "%-8s %s\n", name, value)
+	}
+	field("commit", c.ID)
+	if c.Parent != "" {
+		field("parent", c.Parent)
+	}
+	if c.MergeParent != "" {
+		field("merge", c.MergeParent)
+	}
+	if c.AuthorName != "" {
+		field("author", c.Author())
+	}
+	field("date", c.Date.Format(time.RFC3339))
+	field("files", strings.Join(c.Files, " "))
+	if len(c.Deleted) > 0 {
+		field("deleted", strings.Join(c.Deleted, " "))
+	}
+	if len(c.Renamed) > 0 {
+		field("renamed", strings.Join(c.Renamed, " "))
+	}
+	b.WriteString("\n")
+	for _, line := range strings.Split(c.Message, "\n") {
+		b.WriteString(messageIndent + line + "\n")
+	}
+	return b.String()
+}
+
+func cmdCatFile(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("cat-file", flag.ExitOnError)
+	showType := fs.Bool("t", false, "print the object's type")
+	pretty := fs.Bool("p", false, "pretty-print the commit's fields")
+	fs.Parse(args)
+	if fs.NArg() != 1 || (*showType && *pretty) {
+		fmt.Println("Usage: fool cat-file [-t | -p] <commit>")
+		os.Exit(1)
+	}
+	id, err := resolveRef(fs.Arg(0))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	switch {
+	case *showType:
+		fmt.Println("commit")
+	case *pretty:
+		c, err := loadCommit(id)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Print(prettyCommit(c))
+	default:
+		data, err := os.ReadFile(filepath.Join(".fool", "objects", id, "meta.txt"))
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(data)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// cleanTargets turns the untracked files status reports into what fool
+// clean removes. Files in a directory that holds tracked files are removed
+// one by one. A directory holding no tracked file is removed whole, listed
+// as "dir/", when dirs is set, and left alone otherwise.
+func cleanTargets(untracked []string, tracked map[string]bool, dirs bool) []string {
+	var targets []string
+	seen := map[string]bool{}
+	for _, f := range untracked {
+		dir := untrackedDir(f, tracked)
+		if dir == "" {
+			targets = append(targets, f)
+		} else if dirs && !seen[dir] {
+			seen[dir] = true
+			targets = append(targets, dir)
+		}
+	}
+	return targets
+}
+
+// untrackedDir returns the outermost directory above f, with a trailing
+// "/", that holds no tracked file, or "" if every directory above f does.
+func untrackedDir(f string, tracked map[string]bool) string {
+	parts := strings.Split(f, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/") + "/"
+		holdsTracked := false
+		for t := range tracked {
+			if strings.HasPrefix(t, dir) {
+				holdsTracked = true
+				break
+			}
+		}
+		if !holdsTracked {
+			return dir
+		}
+	}
+	return ""
+}
+
+func cmdClean(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	force := fs.Bool("f", false, "really remove the files")
+	dryRun := fs.Bool("n", false, "only list what would be removed (the default)")
+	dirs := fs.Bool("d", false, "also remove untracked directories")
+	ignored := fs.Bool("x", false, "also remove files matched by .foolignore")
+	fs.Parse(args)
+	var patterns []string
+	if !*ignored {
+		patterns = parseIgnorePatterns(".foolignore")
+	}
+	tracked := trackedPaths()
+	untracked := cleanTargets(untrackedFiles(tracked, patterns), tracked, *dirs)
+	if !*force || *dryRun {
+		for _, p := range untracked {
+			fmt.Printf("Would remove %s\n", p)
+		}
+		if len(untracked) > 0 && !*dryRun {
+			fmt.Println("Nothing removed; use -f to delete these files.")
+		}
+		return
+	}
+	for _, p := range untracked {
+		if err := os.RemoveAll(p); err != nil {
+			fmt.Printf("Error removing '%s': %v\n", p, err)
+			continue
+		}
+		fmt.Printf("Removing %s\n", p)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// ANSI escape codes used to color terminal output.
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorDim    = "\033[2m"
+)
+
+// useColor is set by main when stdout is a terminal, or FOOL_COLOR=always
+// forces it on for pipes and files, unless NO_COLOR is set or -no-color was
+// given.
+var useColor bool
+
+// stdoutIsTerminal reports whether stdout is a character device rather than
+// a file or pipe.
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in color when color output is on.
+func colorize(color, s string) string {
+	if !useColor || s == "" {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// colorDiff colors the added lines of a unified diff green and the removed
+// ones red, leaving the ---/+++ file headers alone.
+func colorDiff(patch string) string {
+	if !useColor || patch == "" {
+		return patch
+	}
+	lines := strings.SplitAfter(patch, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+		case strings.HasPrefix(line, "+"):
+			lines[i] = colorize(colorGreen, strings.TrimSuffix(line, "\n")) + "\n"
+		case strings.HasPrefix(line, "-"):
+			lines[i] = colorize(colorRed, strings.TrimSuffix(line, "\n")) + "\n"
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// colorLogDate dims the value of the Date: line of a log entry.
+func colorLogDate(entry string) string {
+	if !useColor {
+		return entry
+	}
+	lines := strings.Split(entry, "\n")
+	for i, line := range lines {
+		if date, ok := strings.CutPrefix(line, "Date: "); ok {
+			lines[i] = "Date: " + colorize(colorDim, date)
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
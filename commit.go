@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CommitMeta is the parsed form of a commit's meta.txt.
+type CommitMeta struct {
+	ID          string
+	Parent      string // "" for the initial commit
+	MergeParent string // the commit merged in, for merge commits
+	AuthorName  string
+	AuthorEmail string
+	Date        time.Time
+	Message     string
+	Files       []string
+	Deleted     []string
+	Renamed     []string // "<src>-><dst>"
+}
+
+// loadCommit reads the meta.txt of commit id. Commits made before parents
+// were recorded take the commit logged before them as their parent.
+func loadCommit(id string) (*CommitMeta, error) {
+	meta, err := readMeta(id)
+	if err != nil {
+		return nil, err
+	}
+	c := &CommitMeta{
+		ID:          id,
+		AuthorName:  meta["author.name"],
+		AuthorEmail: meta["author.email"],
+		Message:     meta["message"],
+		Files:       parseFileList(meta["files"]),
+		Deleted:     parseFileList(meta["deleted"]),
+		Renamed:     parseFileList(meta["renamed"]),
+		MergeParent: meta["merge"],
+	}
+	c.Date, _ = time.Parse(time.RFC3339, meta["date"])
+	if parent, ok := meta["parent"]; !ok {
+		c.Parent = previousCommitID(id)
+	} else if parent != "none" {
+		c.Parent = parent
+	}
+	return c, nil
+}
+
+// parents returns the commits c was made on top of: its parent, followed by
+// the merged commit for a merge.
+func (c *CommitMeta) parents() []string {
+	var ids []string
+	for _, id := range []string{c.Parent, c.MergeParent} {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// commitHistory returns the commits reachable from id by following parents,
+// newest first. Where a merge brings in a second line of history, the newest
+// pending commit is taken next, and of equally old ones the first found, so
+// a linear history comes out exactly in parent order.
+func commitHistory(id string) []*CommitMeta {
+	var commits, pending []*CommitMeta
+	seen := map[string]bool{}
+	visit := func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		if c, err := loadCommit(id); err == nil {
+			pending = append(pending, c)
+		}
+	}
+	if id != "" {
+		visit(id)
+	}
+	for len(pending) > 0 {
+		next := 0
+		for i, c := range pending {
+			if c.Date.After(pending[next].Date) {
+				next = i
+			}
+		}
+		c := pending[next]
+		pending = append(pending[:next], pending[next+1:]...)
+		commits = append(commits, c)
+		for _, p := range c.parents() {
+			visit(p)
+		}
+	}
+	return commits
+}
+
+// Subject returns the first line of the commit message.
+func (c *CommitMeta) Subject() string {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return subject
+}
+
+// ShortID returns the abbreviated commit ID shown by default.
+func (c *CommitMeta) ShortID() string {
+	return abbrevID(c.ID, defaultAbbrev)
+}
+
+// Author returns the author as "name <email>", or "" for commits made
+// before authors were recorded.
+func (c *CommitMeta) Author() string {
+	if c.AuthorName == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s <%s>", c.AuthorName, c.AuthorEmail)
+}
+
+// metaText renders c in the meta.txt format read back by readMeta.
+func (c *CommitMeta) metaText() string {
+	parent := c.Parent
+	if parent == "" {
+		parent = "none"
+	}
+	meta := fmt.Sprintf("commit: %s\nparent: %s\nauthor.name: %s\nauthor.email: %s\ndate: %s\nmessage: %s\nfiles: %v\n",
+		c.ID, parent, c.AuthorName, c.AuthorEmail, c.Date.Format(time.RFC3339), encodeMessage(c.Message), c.Files)
+	if c.MergeParent != "" {
+		meta += fmt.Sprintf("merge: %s\n", c.MergeParent)
+	}
+	if len(c.Deleted) > 0 {
+		meta += fmt.Sprintf("deleted: %v\n", c.Deleted)
+	}
+	if len(c.Renamed) > 0 {
+		meta += fmt.Sprintf("renamed: %v\n", c.Renamed)
+	}
+	return meta
+}
+
+// logEntry renders c as an entry of .fool/log, without the blank line that
+// separates entries.
+func (c *CommitMeta) logEntry() string {
+	entry := fmt.Sprintf("commit %s\n", c.ID)
+	if c.MergeParent != "" {
+		entry += fmt.Sprintf("Merge: %s\n", c.MergeParent)
+	}
+	if c.AuthorName != "" {
+		entry += fmt.Sprintf("Author: %s <%s>\n", c.AuthorName, c.AuthorEmail)
+	}
+	entry += fmt.Sprintf("Date: %s\nMessage: %s\nFiles: %v\n", c.Date.Format(time.RFC3339), encodeMessage(c.Message), c.Files)
+	if len(c.Deleted) > 0 {
+		entry += fmt.Sprintf("Deleted: %v\n", c.Deleted)
+	}
+	if len(c.Renamed) > 0 {
+		entry += fmt.Sprintf("Renamed: %v\n", c.Renamed)
+	}
+	return entry
+}
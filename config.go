@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// loadConfig reads .fool/config, an INI-like file of [section] headers and
+// key = value lines, into a map keyed by "section.key". Section and key
+// names are case-insensitive and stored lowercased; a quoted subsection as
+// in [remote "origin"] is kept as-is, giving "remote.origin.url".
+func loadConfig() map[string]string {
+	config := map[string]string{}
+	data, err := os.ReadFile(filepath.Join(".fool", "config"))
+	if err != nil {
+		return config
+	}
+	section := ""
+	for _, line := range splitLines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			header := strings.TrimSpace(line[1 : len(line)-1])
+			if i := strings.IndexByte(header, ' '); i >= 0 {
+				sub := strings.Trim(strings.TrimSpace(header[i+1:]), `"`)
+				section = strings.ToLower(header[:i]) + "." + sub
+			} else {
+				section = strings.ToLower(header)
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if section != "" {
+			key = section + "." + key
+		}
+		config[key] = value
+	}
+	return config
+}
+
+// saveConfig writes config to .fool/config in the format loadConfig reads,
+// grouping keys by section and sorting them. Comments in the old file are not
+// kept.
+func saveConfig(config map[string]string) error {
+	sections := map[string][]string{}
+	var headers []string
+	for name, value := range config {
+		i := strings.LastIndexByte(name, '.')
+		if i <= 0 || i == len(name)-1 {
+			return fmt.Errorf("invalid config key '%s'", name)
+		}
+		header := "[" + name[:i] + "]"
+		if section, sub, ok := strings.Cut(name[:i], "."); ok {
+			header = fmt.Sprintf("[%s \"%s\"]", section, sub)
+		}
+		if _, ok := sections[header]; !ok {
+			headers = append(headers, header)
+		}
+		sections[header] = append(sections[header], fmt.Sprintf("\t%s = %s\n", name[i+1:], value))
+	}
+	sort.Strings(headers)
+	var out strings.Builder
+	for _, header := range headers {
+		lines := sections[header]
+		sort.Strings(lines)
+		out.WriteString(header + "\n")
+		for _, line := range lines {
+			out.WriteString(line)
+		}
+	}
+	return os.WriteFile(filepath.Join(".fool", "config"), []byte(out.String()), 0644)
+}
+
+// normalizeConfigKey lowercases the section and key of name, leaving any
+// subsection as written, to match the keys loadConfig produces.
+func normalizeConfigKey(name string) (string, bool) {
+	first := strings.IndexByte(name, '.')
+	last := strings.LastIndexByte(name, '.')
+	if first <= 0 || last == len(name)-1 {
+		return "", false
+	}
+	return strings.ToLower(name[:first]) + name[first:last] + strings.ToLower(name[last:]), true
+}
+
+func cmdConfig(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	list := fs.Bool("list", false, "list all config values")
+	fs.BoolVar(list, "l", false, "list all config values")
+	fs.Parse(args)
+	config := loadConfig()
+	if *list {
+		keys := make([]string, 0, len(config))
+		for k := range config {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("%s=%s\n", k, config[k])
+		}
+		return
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fmt.Println("Usage: fool config <key> [value] | --list")
+		os.Exit(1)
+	}
+	key, ok := normalizeConfigKey(fs.Arg(0))
+	if !ok {
+		fmt.Printf("Error: invalid key '%s'; keys look like section.name\n", fs.Arg(0))
+		os.Exit(1)
+	}
+	if fs.NArg() == 1 {
+		value, ok := config[key]
+		if !ok {
+			os.Exit(1)
+		}
+		fmt.Println(value)
+		return
+	}
+	config[key] = fs.Arg(1)
+	if err := saveConfig(config); err != nil {
+		fmt.Println("Error writing config:", err)
+		os.Exit(1)
+	}
+}
+
+// configBool interprets a config value the way git does: true, yes, on and 1
+// are true, everything else is false.
+func configBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
+// resolveAuthor determines the identity recorded in new commits: the
+// FOOL_AUTHOR_NAME and FOOL_AUTHOR_EMAIL environment variables win, then
+// user.name and user.email from .fool/config, then $USER@<hostname>.
+func resolveAuthor(config map[string]string) (name, email string) {
+	name = os.Getenv("FOOL_AUTHOR_NAME")
+	if name == "" {
+		name = config["user.name"]
+	}
+	email = os.Getenv("FOOL_AUTHOR_EMAIL")
+	if email == "" {
+		email = config["user.email"]
+	}
+	user := os.Getenv("USER")
+	if user == "" {
+		user = "unknown"
+	}
+	if name == "" {
+		name = user
+	}
+	if email == "" {
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "localhost"
+		}
+		email = user + "@" + host
+	}
+	return name, email
+}
+
+// parseIdent splits an identity of the form "Name <email>".
+func parseIdent(ident string) (name, email string, ok bool) {
+	open := strings.LastIndex(ident, "<")
+	if open < 0 || !strings.HasSuffix(ident, ">") {
+		return "", "", false
+	}
+	name = strings.TrimSpace(ident[:open])
+	email = ident[open+1 : len(ident)-1]
+	if name == "" || email == "" {
+		return "", "", false
+	}
+	return name, email, true
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// strftimeLayouts maps strftime conversions to Go reference-time layouts.
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'z': "-0700",
+	'Z': "MST",
+	'j': "002",
+}
+
+// validDateFormat reports whether format is accepted by formatDate.
+func validDateFormat(format string) bool {
+	switch format {
+	case "", "default", "relative", "local", "short", "iso", "iso8601", "iso-strict", "iso8601-strict", "rfc", "rfc2822", "unix":
+		return true
+	}
+	return strings.HasPrefix(format, "format:")
+}
+
+// formatDate renders t according to a log --date style. Unknown styles fall
+// back to RFC3339, which is how dates are stored in the log.
+func formatDate(t time.Time, format string) string {
+	switch format {
+	case "relative":
+		return relativeDate(time.Since(t))
+	case "local":
+		return t.Local().Format("Mon Jan 2 15:04:05 2006")
+	case "short":
+		return t.Format("2006-01-02")
+	case "iso", "iso8601":
+		return t.Format("2006-01-02 15:04:05 -0700")
+	case "iso-strict", "iso8601-strict":
+		return t.Format(time.RFC3339)
+	case "rfc", "rfc2822":
+		return t.Format("Mon, 2 Jan 2006 15:04:05 -0700")
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	if strings.HasPrefix(format, "format:") {
+		return strftime(t, strings.TrimPrefix(format, "format:"))
+	}
+	return t.Format(time.RFC3339)
+}
+
+// strftime expands strftime-like %-conversions in format. Each conversion is
+// rendered on its own so literal text is never mistaken for a layout token.
+func strftime(t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		c := format[i]
+		switch {
+		case c == '%':
+			b.WriteByte('%')
+		case c == 's':
+			b.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case strftimeLayouts[c] != "":
+			b.WriteString(t.Format(strftimeLayouts[c]))
+		default:
+			b.WriteByte('%')
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func relativeDate(d time.Duration) string {
+	if d < 0 {
+		return "in the future"
+	}
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	secs := int(d.Seconds())
+	switch {
+	case secs < 90:
+		return plural(secs, "second")
+	case secs < 90*60:
+		return plural((secs+30)/60, "minute")
+	case secs < 36*3600:
+		return plural((secs+1800)/3600, "hour")
+	}
+	days := (secs + 43200) / 86400
+	switch {
+	case days < 14:
+		return plural(days, "day")
+	case days < 70:
+		return plural((days+3)/7, "week")
+	case days < 365:
+		return plural((days+15)/30, "month")
+	}
+	return plural((days+182)/365, "year")
+}
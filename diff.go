@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// diffOp is a single line of an edit script: ' ' for a line common to both
+// sides, '-' for a line only in the old version and '+' for one only in the new.
+type diffOp struct {
+	Kind byte
+	Line string
+}
+
+// splitContentLines splits file content into lines without their trailing
+// newlines. A final newline does not produce an extra empty line.
+func splitContentLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	s := strings.TrimSuffix(string(data), "\n")
+	return strings.Split(s, "\n")
+}
+
+// diffLines computes a shortest edit script turning a into b using Myers'
+// O(ND) algorithm. Common leading and trailing lines are stripped first since
+// most edits only touch a small part of a file.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		ops = append(ops, diffOp{' ', a[pre]})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ops = append(ops, myersDiff(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, line := range a[len(a)-suf:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	max := n + m
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				return myersBacktrack(trace, a, b, max)
+			}
+		}
+	}
+	return nil
+}
+
+func myersBacktrack(trace [][]int, a, b []string, max int) []diffOp {
+	var rev []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[max+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			rev = append(rev, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			rev = append(rev, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	ops := make([]diffOp, len(rev))
+	for i, op := range rev {
+		ops[len(rev)-1-i] = op
+	}
+	return ops
+}
+
+// computeDiffStat returns the number of lines added and removed going from
+// oldData to newData.
+func computeDiffStat(oldData, newData []byte) (added, removed int) {
+	for _, op := range diffLines(splitContentLines(oldData), splitContentLines(newData)) {
+		switch op.Kind {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// errBinaryFile is returned by computeFileStat when either side is binary
+// and has no meaningful line count.
+var errBinaryFile = errors.New("binary file")
+
+// computeFileStat returns the number of lines added and removed going from
+// the file at oldPath to the one at newPath. An empty or missing path stands
+// for a file that does not exist on that side.
+func computeFileStat(oldPath, newPath string) (added, removed int, err error) {
+	var data [2][]byte
+	for i, path := range []string{oldPath, newPath} {
+		if path == "" {
+			continue
+		}
+		data[i], err = os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, 0, err
+		}
+	}
+	if isBinary(data[0]) || isBinary(data[1]) {
+		return 0, 0, errBinaryFile
+	}
+	added, removed = computeDiffStat(data[0], data[1])
+	return added, removed, nil
+}
+
+// fileStat is one line of a --stat summary.
+type fileStat struct {
+	path           string
+	added, removed int
+	binary         bool
+}
+
+// changedPaths returns, sorted, the files whose content or existence differs
+// between the snapshots of parent and id. An empty parent means the commit
+// added everything.
+func changedPaths(parent, id string) []string {
+	paths := snapshotFiles(id)
+	for _, f := range snapshotFiles(parent) {
+		if !containsString(paths, f) {
+			paths = append(paths, f)
+		}
+	}
+	sort.Strings(paths)
+	var changed []string
+	for _, f := range paths {
+		oldData, oldErr := os.ReadFile(filepath.Join(".fool", "objects", parent, f))
+		newData, newErr := os.ReadFile(filepath.Join(".fool", "objects", id, f))
+		oldExists := parent != "" && oldErr == nil
+		if oldExists != (newErr == nil) || !bytes.Equal(oldData, newData) {
+			changed = append(changed, f)
+		}
+	}
+	return changed
+}
+
+// commitStat counts the lines each file changed between parent and id.
+func commitStat(parent, id string) []fileStat {
+	var stats []fileStat
+	for _, f := range changedPaths(parent, id) {
+		oldPath := ""
+		if parent != "" {
+			oldPath = filepath.Join(".fool", "objects", parent, f)
+		}
+		added, removed, err := computeFileStat(oldPath, filepath.Join(".fool", "objects", id, f))
+		stats = append(stats, fileStat{f, added, removed, err == errBinaryFile})
+	}
+	return stats
+}
+
+// commitPatch returns the unified diff of every file changed between parent
+// and id, as fool diff would print it.
+func commitPatch(parent, id string) string {
+	diffs, _ := diffCommits(parent, id)
+	var b strings.Builder
+	for _, d := range diffs {
+		b.WriteString(d.Unified())
+	}
+	return b.String()
+}
+
+// FileDiff is one file that differs between two versions of the tree.
+type FileDiff struct {
+	Path                 string
+	OldData, NewData     []byte
+	OldExists, NewExists bool
+}
+
+// Unified renders d as a unified diff, as fool diff prints it.
+func (d FileDiff) Unified() string {
+	return unifiedDiff(d.Path, d.OldData, d.NewData, d.OldExists, d.NewExists)
+}
+
+// diffCommits compares the snapshots of commits id1 and id2. Files only in
+// id1 come out as deletions and files only in id2 as additions. An empty id1
+// stands for the empty tree before the first commit.
+func diffCommits(id1, id2 string) ([]FileDiff, error) {
+	for _, id := range []string{id1, id2} {
+		if id == "" {
+			continue
+		}
+		if _, err := loadCommit(id); err != nil {
+			return nil, fmt.Errorf("unknown commit '%s'", id)
+		}
+	}
+	var diffs []FileDiff
+	for _, f := range changedPaths(id1, id2) {
+		oldData, oldErr := os.ReadFile(filepath.Join(".fool", "objects", id1, f))
+		newData, newErr := os.ReadFile(filepath.Join(".fool", "objects", id2, f))
+		diffs = append(diffs, FileDiff{f, oldData, newData, id1 != "" && oldErr == nil, newErr == nil})
+	}
+	return diffs, nil
+}
+
+// diffCommitWorktree compares the snapshot of commit id with the working
+// directory, covering the files of id and those tracked now.
+func diffCommitWorktree(id string) ([]FileDiff, error) {
+	if _, err := loadCommit(id); err != nil {
+		return nil, fmt.Errorf("unknown commit '%s'", id)
+	}
+	paths := snapshotFiles(id)
+	for f := range trackedPaths() {
+		if !containsString(paths, f) {
+			paths = append(paths, f)
+		}
+	}
+	sort.Strings(paths)
+	var diffs []FileDiff
+	for _, f := range paths {
+		oldData, oldErr := os.ReadFile(filepath.Join(".fool", "objects", id, f))
+		newData, newErr := os.ReadFile(f)
+		if (oldErr == nil) == (newErr == nil) && bytes.Equal(oldData, newData) {
+			continue
+		}
+		diffs = append(diffs, FileDiff{f, oldData, newData, oldErr == nil, newErr == nil})
+	}
+	return diffs, nil
+}
+
+// statGraphWidth is the widest the +/- graph of a --stat line may get.
+const statGraphWidth = 50
+
+// formatStat renders stats like git's --stat: one "path | count +++--" line
+// per file, scaled to statGraphWidth, then a summary line.
+func formatStat(stats []fileStat) string {
+	nameWidth, countWidth, most := 0, 1, 0
+	insertions, deletions := 0, 0
+	for _, s := range stats {
+		nameWidth = max(nameWidth, len(s.path))
+		countWidth = max(countWidth, len(fmt.Sprint(s.added+s.removed)))
+		most = max(most, s.added+s.removed)
+		insertions += s.added
+		deletions += s.removed
+	}
+	var b strings.Builder
+	for _, s := range stats {
+		if s.binary {
+			fmt.Fprintf(&b, " %-*s | %*s\n", nameWidth, s.path, countWidth, "Bin")
+			continue
+		}
+		plus, minus := s.added, s.removed
+		if most > statGraphWidth {
+			plus = (plus*statGraphWidth + most - 1) / most
+			minus = (minus*statGraphWidth + most - 1) / most
+		}
+		fmt.Fprintf(&b, " %-*s | %*d %s%s\n", nameWidth, s.path, countWidth, s.added+s.removed,
+			strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+	summary := fmt.Sprintf(" %d files changed", len(stats))
+	if len(stats) == 1 {
+		summary = " 1 file changed"
+	}
+	if insertions > 0 {
+		summary += fmt.Sprintf(", %d insertion%s(+)", insertions, plural(insertions))
+	}
+	if deletions > 0 {
+		summary += fmt.Sprintf(", %d deletion%s(-)", deletions, plural(deletions))
+	}
+	b.WriteString(summary + "\n")
+	return b.String()
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+type hunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	ops                []diffOp
+}
+
+// buildHunks groups an edit script into unified-diff hunks with diffContext
+// lines of context, merging changes whose context would overlap.
+func buildHunks(ops []diffOp) []hunk {
+	// oldAt[i] and newAt[i] are the 1-based line numbers of ops[i] on each side.
+	oldAt := make([]int, len(ops)+1)
+	newAt := make([]int, len(ops)+1)
+	o, n := 1, 1
+	var changes []int
+	for i, op := range ops {
+		oldAt[i], newAt[i] = o, n
+		if op.Kind != '+' {
+			o++
+		}
+		if op.Kind != '-' {
+			n++
+		}
+		if op.Kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	oldAt[len(ops)], newAt[len(ops)] = o, n
+
+	var hunks []hunk
+	for g := 0; g < len(changes); {
+		first, last := changes[g], changes[g]
+		g++
+		for g < len(changes) && changes[g]-last <= 2*diffContext {
+			last = changes[g]
+			g++
+		}
+		start := first - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := last + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		h := hunk{
+			oldStart: oldAt[start],
+			newStart: newAt[start],
+			oldLines: oldAt[end] - oldAt[start],
+			newLines: newAt[end] - newAt[start],
+			ops:      ops[start:end],
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+// isBinary reports whether data looks like binary content, using the same
+// NUL-byte heuristic as git on the first 8000 bytes.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// unifiedDiff renders the changes between two versions of path as a unified
+// diff. A missing side is shown as /dev/null. It returns "" if the contents
+// are identical.
+func unifiedDiff(path string, oldData, newData []byte, oldExists, newExists bool) string {
+	if oldExists == newExists && bytes.Equal(oldData, newData) {
+		return ""
+	}
+	oldName, newName := "a/"+path, "b/"+path
+	if !oldExists {
+		oldName = "/dev/null"
+	}
+	if !newExists {
+		newName = "/dev/null"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	if isBinary(oldData) || isBinary(newData) {
+		b.WriteString("Binary files differ\n")
+		return b.String()
+	}
+	hunks := buildHunks(diffLines(splitContentLines(oldData), splitContentLines(newData)))
+	if len(hunks) == 0 {
+		return ""
+	}
+	for _, h := range hunks {
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(h.oldStart, h.oldLines), hunkRange(h.newStart, h.newLines))
+		for _, op := range h.ops {
+			b.WriteByte(op.Kind)
+			b.WriteString(op.Line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// hunkRange formats one side of a hunk header. An empty side is reported as
+// starting at the line before the change, as patch expects.
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+func cmdDiff(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	cached := fs.Bool("cached", false, "show the staged changes instead of the unstaged ones")
+	fs.Parse(args)
+	// Leading arguments naming commits rather than files select what to
+	// compare; "--" ends them explicitly.
+	var commits []string
+	rest := fs.Args()
+	for len(rest) > 0 && len(commits) < 2 && rest[0] != "--" {
+		if _, err := os.Stat(rest[0]); err == nil {
+			break
+		}
+		id, err := resolveRef(rest[0])
+		if err != nil {
+			break
+		}
+		commits = append(commits, id)
+		rest = rest[1:]
+	}
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	}
+	if *cached {
+		if len(commits) > 0 {
+			fmt.Println("Error: --cached cannot be combined with commits.")
+			os.Exit(1)
+		}
+		diffCached(rest)
+		return
+	}
+	if len(commits) > 0 {
+		var diffs []FileDiff
+		var err error
+		if len(commits) == 2 {
+			diffs, err = diffCommits(commits[0], commits[1])
+		} else {
+			diffs, err = diffCommitWorktree(commits[0])
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for i := range rest {
+			rest[i] = filepath.ToSlash(filepath.Clean(rest[i]))
+		}
+		for _, d := range diffs {
+			if len(rest) == 0 || containsString(rest, d.Path) {
+				fmt.Print(colorDiff(d.Unified()))
+			}
+		}
+		return
+	}
+	lastCommitFiles, lastCommitID := getLastCommitFilesAndID()
+	tracked := snapshotFiles(lastCommitID)
+	files := tracked
+	if len(rest) > 0 {
+		files = nil
+		for _, f := range rest {
+			f = filepath.ToSlash(filepath.Clean(f))
+			if !containsString(tracked, f) {
+				fmt.Printf("File '%s' is not tracked.\n", f)
+				continue
+			}
+			files = append(files, f)
+		}
+	}
+	for _, f := range files {
+		oldData, oldErr := os.ReadFile(filepath.Join(".fool", "objects", lastCommitID, f))
+		newData, newErr := os.ReadFile(f)
+		fmt.Print(colorDiff(unifiedDiff(f, oldData, newData, oldErr == nil && lastCommitFiles[f], newErr == nil)))
+	}
+}
+
+// diffCached prints what the next commit would change: each file in the
+// index against its version in HEAD, or against /dev/null if HEAD does not
+// have it. Staged removals diff against /dev/null on the new side, and a
+// staged rename shows as removing the old path and adding the new one. With
+// paths, only those files are shown.
+func diffCached(paths []string) {
+	headFiles, headID := getLastCommitFilesAndID()
+	type change struct {
+		path    string
+		removed bool
+	}
+	var changes []change
+	for _, line := range readIndex() {
+		if f, ok := strings.CutPrefix(line, deleteMarker); ok {
+			changes = append(changes, change{f, true})
+		} else if src, dst, ok := parseRename(line); ok {
+			changes = append(changes, change{src, true}, change{dst, false})
+		} else {
+			changes = append(changes, change{line, false})
+		}
+	}
+	for i := range paths {
+		paths[i] = filepath.ToSlash(filepath.Clean(paths[i]))
+	}
+	shown := map[string]bool{}
+	for _, c := range changes {
+		f := filepath.ToSlash(filepath.Clean(c.path))
+		if shown[f] || (len(paths) > 0 && !containsString(paths, f)) {
+			continue
+		}
+		shown[f] = true
+		oldData, oldErr := os.ReadFile(filepath.Join(".fool", "objects", headID, f))
+		var newData []byte
+		newExists := false
+		if !c.removed {
+			var err error
+			newData, err = os.ReadFile(f)
+			newExists = err == nil
+		}
+		fmt.Print(colorDiff(unifiedDiff(f, oldData, newData, oldErr == nil && headFiles[f], newExists)))
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// reachableCommits returns every commit that can be reached by following
+// parents from .fool/log, the branch, tag and remote-tracking refs, HEAD, the
+// reflog and the commits stashes were made on.
+func reachableCommits() map[string]bool {
+	var roots []string
+	if data, err := os.ReadFile(".fool/log"); err == nil {
+		for _, entry := range splitLogEntries(string(data)) {
+			roots = append(roots, logEntryField(entry, "commit "))
+		}
+	}
+	for _, b := range listRefs("heads") {
+		roots = append(roots, readBranch(b))
+	}
+	for _, t := range listRefs("tags") {
+		if data, err := os.ReadFile(tagRefPath(t)); err == nil {
+			roots = append(roots, strings.TrimSpace(string(data)))
+		}
+	}
+	for _, r := range listRefs("remotes") {
+		if data, err := os.ReadFile(filepath.Join(".fool", "refs", "remotes", filepath.FromSlash(r))); err == nil {
+			roots = append(roots, strings.TrimSpace(string(data)))
+		}
+	}
+	roots = append(roots, headCommitID())
+	for _, n := range stashNumbers() {
+		if data, err := os.ReadFile(stashPath(n)); err == nil {
+			on := strings.Fields(stashHeader(string(data), "On"))
+			if len(on) > 0 {
+				roots = append(roots, on[len(on)-1])
+			}
+		}
+	}
+	// The reflog keeps commits alive so they can still be recovered.
+	for _, e := range readReflog() {
+		roots = append(roots, e.New, e.Old)
+	}
+	// One walk shared by all roots: most of them lead into the same history,
+	// so it stops at any commit already found.
+	reachable := map[string]bool{}
+	for len(roots) > 0 {
+		id := roots[len(roots)-1]
+		roots = roots[:len(roots)-1]
+		if id == "" || reachable[id] {
+			continue
+		}
+		c, err := loadCommit(id)
+		if err != nil {
+			continue
+		}
+		reachable[id] = true
+		roots = append(roots, c.parents()...)
+	}
+	return reachable
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func cmdGC(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "list unreachable objects without removing them")
+	fs.Parse(args)
+	reachable := reachableCommits()
+	entries, _ := os.ReadDir(filepath.Join(".fool", "objects"))
+	var unreachable []string
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != blobsDir && !reachable[e.Name()] {
+			unreachable = append(unreachable, e.Name())
+		}
+	}
+	sort.Strings(unreachable)
+	var freed int64
+	removed := 0
+	for _, id := range unreachable {
+		dir := filepath.Join(".fool", "objects", id)
+		size := dirSize(dir)
+		if *dryRun {
+			fmt.Printf("Would remove %s (%d bytes)\n", id, size)
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Printf("Error removing %s: %v\n", id, err)
+			continue
+		}
+		removed++
+		freed += size
+	}
+	if *dryRun {
+		fmt.Printf("%d unreachable object(s).\n", len(unreachable))
+		return
+	}
+	fmt.Printf("Removed %d unreachable objects, freed %d bytes.\n", removed, freed)
+}
+
+// objectCounts is the summary fool count-objects prints. Commits keep whole
+// file trees; blobs are only the files hash-object -w stored.
+type objectCounts struct {
+	Commits     int   `json:"commits"`
+	Blobs       int   `json:"blobs"`
+	SizeBytes   int64 `json:"size_bytes"`
+	Unreachable int   `json:"unreachable"`
+}
+
+func cmdCountObjects(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("count-objects", flag.ExitOnError)
+	var verbose bool
+	fs.BoolVar(&verbose, "v", false, "list the size of each commit object")
+	fs.BoolVar(&verbose, "verbose", false, "list the size of each commit object")
+	asJSON := fs.Bool("json", false, "print the counts as a JSON object")
+	fs.Parse(args)
+	reachable := reachableCommits()
+	entries, _ := os.ReadDir(filepath.Join(".fool", "objects"))
+	var counts objectCounts
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if e.Name() == blobsDir {
+			blobs, _ := os.ReadDir(filepath.Join(".fool", "objects", blobsDir))
+			counts.Blobs += len(blobs)
+			counts.SizeBytes += dirSize(filepath.Join(".fool", "objects", blobsDir))
+			continue
+		}
+		size := dirSize(filepath.Join(".fool", "objects", e.Name()))
+		counts.Commits++
+		counts.SizeBytes += size
+		note := ""
+		if !reachable[e.Name()] {
+			counts.Unreachable++
+			note = " (unreachable)"
+		}
+		if verbose && !*asJSON {
+			fmt.Printf("%s %d bytes%s\n", abbrevID(e.Name(), defaultAbbrev), size, note)
+		}
+	}
+	if *asJSON {
+		data, _ := json.Marshal(counts)
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Printf("commits: %d\nblobs: %d\nsize: %d bytes\nunreachable: %d\n",
+		counts.Commits, counts.Blobs, counts.SizeBytes, counts.Unreachable)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+func cmdGrep(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("grep", flag.ExitOnError)
+	var ignoreCase bool
+	fs.BoolVar(&ignoreCase, "i", false, "match case-insensitively")
+	fs.BoolVar(&ignoreCase, "ignore-case", false, "match case-insensitively")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fmt.Println("Usage: fool grep [-i] <pattern> [commitID]")
+		return
+	}
+	pattern := fs.Arg(0)
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Println("Error: invalid pattern:", err)
+		os.Exit(1)
+	}
+	commitID := headCommitID()
+	if fs.NArg() == 2 {
+		if commitID, err = resolveRef(fs.Arg(1)); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if commitID == "" {
+		fmt.Println("Error: no commits to search.")
+		os.Exit(1)
+	}
+	files := snapshotFiles(commitID)
+	sort.Strings(files)
+	found := false
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(".fool", "objects", commitID, f))
+		if err != nil {
+			continue
+		}
+		if isBinary(data) {
+			fmt.Printf("Binary file %s skipped\n", f)
+			continue
+		}
+		for i, line := range splitContentLines(data) {
+			if re.MatchString(line) {
+				fmt.Printf("%s:%d:%s\n", f, i+1, line)
+				found = true
+			}
+		}
+	}
+	// Like grep, exit with 1 when nothing matched.
+	if !found {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// blobsDir holds the blobs hash-object --write stores. Commits never refer to
+// them, so gc leaves them alone.
+const blobsDir = "blobs"
+
+// blobPath is where a blob with the given hash is stored.
+func blobPath(sum string) string {
+	return filepath.Join(".fool", "objects", blobsDir, sum)
+}
+
+// hashFile returns the hex SHA-256 of the contents of path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func cmdHashObject(args []string) {
+	fs := flag.NewFlagSet("hash-object", flag.ExitOnError)
+	var write bool
+	fs.BoolVar(&write, "w", false, "store each file as a blob in .fool/objects/blobs")
+	fs.BoolVar(&write, "write", false, "store each file as a blob in .fool/objects/blobs")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Println("Usage: fool hash-object [-w] <file> [<file> ...]")
+		os.Exit(1)
+	}
+	if write {
+		ensureRepo()
+	}
+	failed := false
+	for _, file := range fs.Args() {
+		sum, err := hashFile(file)
+		if err == nil && write {
+			err = copyFileToCommit(file, blobPath(sum))
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			failed = true
+			continue
+		}
+		fmt.Println(sum)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
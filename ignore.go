@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseIgnorePatterns loads the patterns from an ignore file such as
+// .foolignore, skipping blank lines and # comments. A missing file yields
+// no patterns.
+func parseIgnorePatterns(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var patterns []string
+	for _, line := range splitLines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// isIgnored reports whether the slash-separated path name matches one of the
+// patterns. A name ending in "/" denotes a directory. Patterns are matched
+// with filepath.Match: a plain pattern such as "*.o" matches any path
+// component, a pattern with a trailing "/" only matches directories, and a
+// pattern containing a "/" (or starting with one) is anchored at the root.
+func isIgnored(name string, patterns []string) bool {
+	isDir := strings.HasSuffix(name, "/")
+	parts := strings.Split(strings.TrimSuffix(name, "/"), "/")
+	for _, p := range patterns {
+		dirOnly := strings.HasSuffix(p, "/")
+		p = strings.TrimSuffix(p, "/")
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		for i := range parts {
+			last := i == len(parts)-1
+			if last && dirOnly && !isDir {
+				continue
+			}
+			candidate := parts[i]
+			if anchored {
+				candidate = strings.Join(parts[:i+1], "/")
+			}
+			if ok, _ := filepath.Match(p, candidate); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectWorkingFiles walks root and returns every regular file below it as
+// a slash-separated path, skipping repository metadata and ignored files.
+func collectWorkingFiles(root string, patterns []string) []string {
+	var files []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		path = filepath.ToSlash(filepath.Clean(path))
+		if d.IsDir() {
+			if d.Name() == ".fool" || d.Name() == ".git" || (path != "." && isIgnored(path+"/", patterns)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && !isIgnored(path, patterns) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// untrackedFiles returns, in walk order, the non-ignored files anywhere in
+// the working directory that are not in tracked.
+func untrackedFiles(tracked map[string]bool, patterns []string) []string {
+	untracked := []string{}
+	for _, f := range collectWorkingFiles(".", patterns) {
+		if !tracked[f] {
+			untracked = append(untracked, f)
+		}
+	}
+	return untracked
+}
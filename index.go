@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errIndexLocked = errors.New("index is locked by another process")
+
+// lockIndex takes .fool/index.lock, retrying with exponential back-off for
+// up to a second while another process holds it. The returned function
+// releases the lock.
+func lockIndex() (func(), error) {
+	lockPath := filepath.Join(".fool", "index.lock")
+	delay := 10 * time.Millisecond
+	deadline := time.Now().Add(time.Second)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return nil, errIndexLocked
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// readIndex returns the non-empty entries of .fool/index.
+func readIndex() []string {
+	data, err := os.ReadFile(filepath.Join(".fool", "index"))
+	if err != nil {
+		return nil
+	}
+	var entries []string
+	for _, line := range splitLines(string(data)) {
+		if line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries
+}
+
+// writeIndexLocked replaces .fool/index with entries by writing a temporary
+// file and renaming it into place. The caller must hold the index lock.
+func writeIndexLocked(entries []string) error {
+	var content string
+	for _, e := range entries {
+		content += e + "\n"
+	}
+	tmp := filepath.Join(".fool", "index.tmp")
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(".fool", "index")); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeIndex atomically replaces .fool/index with entries.
+func writeIndex(entries []string) error {
+	unlock, err := lockIndex()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return writeIndexLocked(entries)
+}
+
+// updateIndex reads the index, passes it to update and writes the result,
+// holding the lock throughout so concurrent updates are not lost.
+func updateIndex(update func(entries []string) []string) error {
+	unlock, err := lockIndex()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return writeIndexLocked(update(readIndex()))
+}
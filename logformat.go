@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"text/template"
+	"time"
+)
+
+// logFormats are the named templates fool log --format accepts in place of
+// a template string.
+var logFormats = map[string]string{
+	"oneline": "{{.ShortID}} {{.Subject}}",
+	"full":    "commit {{.ID}}\n{{with .MergeParent}}Merge: {{.}}\n{{end}}Author: {{.Author}}\n\n{{.Message}}\n",
+	"fuller": "commit {{.ID}}\n{{with .MergeParent}}Merge: {{.}}\n{{end}}Author: {{.Author}}\nDate:   {{date .Date}}\n\n" +
+		"{{.Message}}\n\nFiles: {{join .Files \" \"}}\n",
+}
+
+// parseLogFormat compiles a --format value, either a name from logFormats
+// or a text/template executed against each *CommitMeta. Templates can use
+// date to render a time in dateFormat, the --date style, and join from
+// package strings.
+func parseLogFormat(format, dateFormat string) (*template.Template, error) {
+	if named, ok := logFormats[format]; ok {
+		format = named
+	}
+	funcs := template.FuncMap{
+		"date": func(t time.Time) string { return formatDate(t, dateFormat) },
+		"join": strings.Join,
+	}
+	return template.New("format").Funcs(funcs).Parse(format)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// indexedFiles returns the files the next commit would hold: those of the
+// HEAD commit with the staged additions, deletions and renames applied.
+func indexedFiles() map[string]bool {
+	files, _ := getLastCommitFilesAndID()
+	for _, line := range readIndex() {
+		if src, dst, ok := parseRename(line); ok {
+			delete(files, src)
+			files[dst] = true
+		} else if f, ok := strings.CutPrefix(line, deleteMarker); ok {
+			delete(files, f)
+		} else {
+			files[filepath.ToSlash(filepath.Clean(line))] = true
+		}
+	}
+	return files
+}
+
+func cmdLsFiles(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("ls-files", flag.ExitOnError)
+	cached := fs.Bool("cached", false, "list tracked files, with staged changes applied (the default)")
+	others := fs.Bool("others", false, "list untracked files")
+	modified := fs.Bool("modified", false, "list tracked files that differ in the working directory")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Println("Usage: fool ls-files [--cached] [--others] [--modified]")
+		return
+	}
+	if !*others && !*modified {
+		*cached = true
+	}
+	listed := map[string]bool{}
+	if *cached {
+		for f := range indexedFiles() {
+			listed[f] = true
+		}
+	}
+	if *others {
+		for _, f := range untrackedFiles(indexedFiles(), parseIgnorePatterns(".foolignore")) {
+			listed[f] = true
+		}
+	}
+	if *modified {
+		for _, f := range modifiedFiles(getLastCommitFilesAndID()) {
+			listed[f] = true
+		}
+	}
+	var files []string
+	for f := range listed {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		fmt.Println(f)
+	}
+}
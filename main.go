@@ -2,21 +2,46 @@ package main
 
 import (
 	"bufio"
-	"crypto/sha1"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
 const foolVersion = "0.1.1"
 
+// deleteMarker prefixes index entries for files staged for removal by rm.
+const deleteMarker = "delete:"
+
+// renameMarker prefixes index entries written by mv, as in
+// "rename:<src>:<dst>".
+const renameMarker = "rename:"
+
+// messageIndent prefixes the continuation lines of multi-line commit messages
+// in meta.txt and .fool/log.
+const messageIndent = "    "
+
+// ensureRepo exits unless the working directory, which the global -C option
+// may have changed, contains a .fool repository.
 func ensureRepo() {
 	if _, err := os.Stat(".fool"); os.IsNotExist(err) {
-		fmt.Println("Error: not a fool repository (run 'fool init' first)")
+		if wd, err := os.Getwd(); err == nil {
+			fmt.Printf("Error: %s is not a fool repository (run 'fool init' first)\n", wd)
+		} else {
+			fmt.Println("Error: not a fool repository (run 'fool init' first)")
+		}
 		os.Exit(1)
 	}
 }
@@ -24,13 +49,43 @@ func ensureRepo() {
 func printUsage() {
 	fmt.Println("fool - a minimal version control system")
 	fmt.Println("Usage:")
-	fmt.Println("  fool <command> [options]")
+	fmt.Println("  fool [-C <dir>] [-no-color] <command> [options]")
 	fmt.Println("Commands:")
-	fmt.Println("  init         Initialize a new repository")
+	fmt.Println("  init [dir]   Initialize a new repository")
 	fmt.Println("  add <file>   Add a file to the staging area")
 	fmt.Println("  commit -m <message>  Commit staged files with a message")
 	fmt.Println("  log          Show commit history")
 	fmt.Println("  status       Show the status of the working directory")
+	fmt.Println("  ls-files [--others] [--modified]  List tracked, untracked or modified files")
+	fmt.Println("  cat-file [-t | -p] <commit>  Print a commit's raw metadata")
+	fmt.Println("  hash-object [-w] <file>  Print the SHA-256 of a file's contents")
+	fmt.Println("  rm <file>    Remove a file from tracking and the working directory")
+	fmt.Println("  mv <src> <dst>  Rename a tracked file")
+	fmt.Println("  revert <commitID>  Commit the inverse of a commit")
+	fmt.Println("  cherry-pick <commitID>  Apply the changes of a commit on top of HEAD")
+	fmt.Println("  blame <file>  Show the commit that last changed each line")
+	fmt.Println("  grep <pattern> [commitID]  Search committed file contents")
+	fmt.Println("  clean [-f] [-d] [-x]  Remove untracked files")
+	fmt.Println("  archive <commitID> <output>  Write a commit's files to a tar or zip archive")
+	fmt.Println("  gc [--dry-run]  Remove unreachable commit objects")
+	fmt.Println("  count-objects [-v] [--json]  Report how much space objects take")
+	fmt.Println("  reflog [expire]  Show where HEAD has been")
+	fmt.Println("  remote [-v | add | remove]  Manage the repositories this one talks to")
+	fmt.Println("  clone <source> <dest>  Copy a repository and check out its branch")
+	fmt.Println("  push <remote> [branch]  Send a branch's commits to a remote")
+	fmt.Println("  serve [--port <n>]  Share the repository read-only over HTTP")
+	fmt.Println("  fetch <remote> [branch]  Copy a remote's new commits")
+	fmt.Println("  pull <remote> [branch]  Fetch and fast-forward to a remote branch")
+	fmt.Println("  config <key> [value]  Get or set a repository option")
+	fmt.Println("  show <commitID>[:<path>]  Show a commit's metadata and changes, or a file in it")
+	fmt.Println("  branch [name]  List or create branches")
+	fmt.Println("  tag [name]     List or create tags")
+	fmt.Println("  merge <branch>  Merge another branch into the current one")
+	fmt.Println("  stash [pop|list|drop]  Shelve local changes and bring them back")
+	fmt.Println("  reset HEAD [file]  Unstage a file, or everything")
+	fmt.Println("  checkout <branch|commitID>  Switch to a branch or restore a commit")
+	fmt.Println("  diff [commit [commit]] [file]  Show changes between commits or the working directory")
+	fmt.Println("  interpret-trailers --parse  Extract trailer lines from a message")
 	fmt.Println("  help [cmd]   Show help for a command")
 	fmt.Println("  version      Show fool version")
 }
@@ -38,15 +93,75 @@ func printUsage() {
 func printCommandHelp(cmd string) {
 	switch cmd {
 	case "init":
-		fmt.Println("Usage: fool init\n  Initialize a new repository.")
+		fmt.Println("Usage: fool init [<directory>]\n  Initialize a new repository in <directory>, creating it if needed, or in\n  the current directory.")
 	case "add":
-		fmt.Println("Usage: fool add <file> [<file> ...]\n  Add a file to the staging area.")
+		fmt.Println("Usage: fool add [-v] [-n] (-u | <file> [<file> ...])\n  Add a file to the staging area. A directory adds every file under it not\n  matched by .foolignore; use '.' for the whole working directory.\n  -v, --verbose  Show added/removed line counts for each file\n  -n, --dry-run  Print the files that would be staged without changing the index\n  -f, --force    Add files even if .foolignore matches them\n  -u, --update   Stage changes to tracked files and deletions of removed ones, ignoring untracked files")
 	case "commit":
-		fmt.Println("Usage: fool commit -m <message>\n  Commit staged files with a message.")
+		fmt.Println("Usage: fool commit -m <message>\n  Commit staged files with a message.\n  -C, --reuse-message=<commit>   Reuse the message of <commit>\n  -c, --reedit-message=<commit>  Like -C, but edit the message first\n  --only <path>...               Commit only <path>, keeping other files staged\n  --exclude <path>...            Commit all staged files except <path>\n  -s, --signoff                  Add a Signed-off-by trailer (default: commit.signOff)\n  --author=\"Name <email>\"       Override the commit author\n  --amend                        Replace the last commit with one that also includes the staged files\n  -F, --file=<file>              Read the message from <file> (- for stdin)\n  -a, --all                      Also commit modified tracked files without adding them")
 	case "log":
-		fmt.Println("Usage: fool log\n  Show commit history.")
+		fmt.Println("Usage: fool log [-n <count>] [--oneline] [--date=<format>] [--grep=<regexp>...] [--author=<regexp>...] [--stat] [-p] [--abbrev=<n>] [--reverse] [--format=<template>] [<file>]\n  Show commit history, optionally only the commits that touched <file>.\n  --oneline  Show '<id> <message>' per commit (default if FOOL_LOG_FORMAT=oneline)\n  -n <count>, --max-count=<count>, -<count>  Show at most <count> commits\n  --date=<format>  relative, local, short, iso, iso-strict, rfc2822, unix or format:<strftime>\n  --grep=<regexp>  Show commits whose message matches; repeat to match any pattern\n  --all-match  Require every --grep pattern to match\n  --author=<regexp>  Show commits whose author name or email matches; repeat to\n                     match any pattern\n  -i  Match --grep and --author patterns case-insensitively\n  --stat  Show how many lines each commit added and removed per file\n  -p, --patch  Show the diff each commit introduced, after any --stat\n  --abbrev=<n>  Show <n> characters of each commit ID (default 8, 0 for all)\n  --reverse  Show the oldest commits first; with -n, the oldest <count>\n  --format=<template>  Print each commit with a Go text/template, e.g.\n                       '{{.ShortID}} {{.Author}} {{.Subject}}', or oneline, full or fuller.\n                       Fields: ID, ShortID, Parent, MergeParent, Author, AuthorName,\n                       AuthorEmail, Date, Message, Subject, Files, Deleted, Renamed;\n                       {{date .Date}} uses the --date format")
 	case "status":
-		fmt.Println("Usage: fool status\n  Show the status of the working directory.")
+		fmt.Println("Usage: fool status [--short | --porcelain]\n  Show the status of the working directory.\n  --short, --porcelain  Print '<XY> <file>' lines (A staged, D deleted, R renamed,\n    M modified, ? untracked) and exit with 1 if anything is staged or modified.\n    --porcelain output is never colored, for use in scripts")
+	case "rm":
+		fmt.Println("Usage: fool rm [-f] [--cached] <file> [<file> ...]\n  Remove files from the working directory and stage their deletion. Files\n  that are staged but not yet committed are only unstaged and kept on disk.\n  -f        Remove files even if they differ from the last commit\n  --cached  Only stop tracking the files, keep them on disk")
+	case "branch":
+		fmt.Println("Usage: fool branch [<name> | -d <name>]\n  List branches, create <name> at the current commit, or delete it with -d.")
+	case "tag":
+		fmt.Println("Usage: fool tag [-l] [-f] [<name> [commitID]] | -d <name>\n  Mark HEAD (or commitID) with a name, list tags, or delete one with -d.\n  -f, --force  Replace an existing tag")
+	case "stash":
+		fmt.Println("Usage: fool stash [push | pop | list | drop <N>]\n  Save changes to tracked files as .fool/stash/stash-<N>.patch and restore\n  them from HEAD. pop applies and removes the newest stash, list shows all\n  stashes and drop deletes one without applying it.")
+	case "mv":
+		fmt.Println("Usage: fool mv <src> <dst>\n  Rename a tracked file on disk and stage the rename. If <dst> is a\n  directory, the file is moved into it.")
+	case "revert":
+		fmt.Println("Usage: fool revert <commitID>\n  Undo the changes of <commitID> in a new commit, leaving history intact.\n  Aborts without touching any file if a change no longer applies.")
+	case "cherry-pick":
+		fmt.Println("Usage: fool cherry-pick <commitID>\n  Apply the changes <commitID> made to its parent and commit them with the\n  message 'cherry-picked from <commitID>: <message>'. Files missing on this\n  branch are skipped with a warning.")
+	case "blame":
+		fmt.Println("Usage: fool blame <file>\n  Print each line of <file> as '<commitID> <date> <line>', naming the commit\n  that last changed it. Uncommitted lines show 00000000.")
+	case "grep":
+		fmt.Println("Usage: fool grep [-i] <pattern> [commitID]\n  Print '<file>:<lineno>:<line>' for each line matching the Go regexp\n  <pattern> in the files of HEAD, or of <commitID>. Binary files are skipped.\n  -i, --ignore-case  Match case-insensitively")
+	case "clean":
+		fmt.Println("Usage: fool clean [-n | -f] [-d] [-x]\n  List the untracked files 'fool status' shows, or remove them with -f.\n  Files in directories that hold no tracked file are only removed with -d.\n  -n  Only list what would be removed (the default)\n  -f  Remove the files\n  -d  Also remove untracked directories, listed as '<dir>/'\n  -x  Also remove files matched by .foolignore")
+	case "archive":
+		fmt.Println("Usage: fool archive [--format=tar|tgz|zip] <commitID> <output>\n  Write the files of <commitID> to an archive without any repository data.\n  Without --format, <output> ending in .zip gives a zip file and .tar.gz or\n  .tgz a gzipped tarball; anything else is a plain tarball.")
+	case "gc":
+		fmt.Println("Usage: fool gc [--dry-run]\n  Remove commit objects that cannot be reached from the log, branches, tags,\n  remote-tracking branches, HEAD, the reflog or stashes.\n  --dry-run  List what would be removed")
+	case "config":
+		fmt.Println("Usage: fool config <key> [value]\n       fool config --list\n  Print the value of <key>, or set it to <value>, in .fool/config. Keys\n  have the form section.name, as in user.name or commit.signoff.\n  -l, --list  Print every key=value pair")
+	case "merge":
+		fmt.Println("Usage: fool merge <branch|commitID>\n  Merge <branch> into the current branch. If HEAD is an ancestor of it the\n  branch is fast-forwarded; otherwise the changes both sides made since\n  their common ancestor are combined and committed as a merge. Conflicting\n  changes are left between <<<<<<< and >>>>>>> markers; resolve them, add\n  the files and commit. The working tree must be clean.")
+	case "ls-files":
+		fmt.Println("Usage: fool ls-files [--cached] [--others] [--modified]\n  Print file names one per line, sorted. Flags can be combined to list the\n  union of their files.\n  --cached    Tracked files, with staged changes applied (the default)\n  --others    Untracked files not matched by .foolignore\n  --modified  Tracked files whose contents differ from the last commit")
+	case "cat-file":
+		fmt.Println("Usage: fool cat-file [-t | -p] <commit>\n  Print the commit's meta.txt exactly as stored. <commit> may be HEAD, a\n  branch, a tag or a commit ID abbreviated to 4 or more characters.\n  -t  Print the object type, which is always 'commit'\n  -p  Print the parsed fields aligned, followed by the message")
+	case "hash-object":
+		fmt.Println("Usage: fool hash-object [-w] <file> [<file> ...]\n  Print the SHA-256 of each file's contents, one per line. Without -w it does\n  not touch the repository and works outside one too.\n  -w, --write  Also store each file as a blob in .fool/objects/blobs/<hash>")
+	case "count-objects":
+		fmt.Println("Usage: fool count-objects [-v] [--json]\n  Count the commit objects in .fool/objects, the blobs stored by\n  'fool hash-object -w', their total size on disk and how many commits\n  'fool gc' would remove.\n  -v, --verbose  Also list each commit object's size\n  --json         Print {\"commits\", \"blobs\", \"size_bytes\", \"unreachable\"} as JSON")
+	case "reflog":
+		fmt.Println("Usage: fool reflog [expire]\n  Show the last 20 moves of HEAD, newest first, as recorded in .fool/reflog\n  by commit, reset, checkout and merge. Use it to find commits that no\n  branch points to any more.\n  expire  Drop entries older than 90 days")
+	case "remote":
+		fmt.Println("Usage: fool remote [-v]\n       fool remote add <name> <path>\n       fool remote remove <name>\n  List the configured remotes, with their URLs if -v is given, or add or\n  remove one. A remote is a local path to another fool repository and is\n  stored as remote.<name>.url in .fool/config.")
+	case "push":
+		fmt.Println("Usage: fool push [--force] <remote> [<branch>]\n  Copy the commits of <branch> (default: the current branch) that the remote\n  lacks into its .fool directory and move its branch to match. The remote's\n  working directory is left alone. A push that would drop commits from the\n  remote branch is rejected.\n  -f, --force  Overwrite the remote branch anyway")
+	case "serve":
+		fmt.Println("Usage: fool serve [--port <n>]\n  Serve the repository read-only over HTTP, without authentication:\n    GET /info/refs            HEAD, branches and tags as '<id>\\t<ref>' lines\n    GET /log                  the commit log\n    GET /objects/<id>/<path>  a file of a commit, such as meta.txt\n    GET /api/commits          every logged commit as JSON, newest first\n  --port <n>  Port to listen on (default 8080)")
+	case "clone":
+		fmt.Println("Usage: fool clone <source> <destination>\n  Create <destination> with a copy of the source repository's history, check\n  out the branch the source has checked out from its commits, and add the\n  source as the remote 'origin'. Uncommitted work in the source is not\n  copied.")
+	case "fetch":
+		fmt.Println("Usage: fool fetch <remote> [<branch>]\n  Copy the commits in the remote's log that this repository lacks and record\n  where its branches (or just <branch>) point as <remote>/<branch>, without\n  changing local branches or files.")
+	case "pull":
+		fmt.Println("Usage: fool pull <remote> [<branch>]\n  Fetch <branch> (default: the current branch) from the remote and\n  fast-forward the current branch to it. If the branches have diverged the\n  fetched commits are kept as <remote>/<branch> to merge by hand.")
+	case "show":
+		fmt.Println("Usage: fool show <commit>\n       fool show <commit>:<path>\n  Show a commit's metadata and a diff against the previous commit, or with\n  :<path>, print the contents of <path> in that commit.\n  <commit> may be HEAD, a branch, a tag or a commit ID abbreviated to 4 or\n  more characters.")
+	case "reset":
+		fmt.Println("Usage: fool reset HEAD [<file> ...]\n       fool reset --soft [HEAD~1]\n  Unstage the given files, or the whole index if none are given.\n  --soft  Undo the last commit, keeping its changes staged")
+	case "checkout":
+		fmt.Println("Usage: fool checkout [--force] <branch|commitID>\n  Switch the working directory to a branch's tip, or detach HEAD at a commit.\n  Refuses while tracked files are modified, changes are staged or untracked\n  files would be overwritten.\n  --force  Discard local modifications and staged changes, and overwrite\n           untracked files")
+	case "diff":
+		fmt.Println("Usage: fool diff [--cached] [<commit> [<commit>]] [--] [<file> ...]\n  Show changes between the working directory and the last commit. With one\n  commit, compare that commit with the working directory; with two, compare\n  the two commits.\n  --cached  Show the staged changes instead: each file in the index against\n            the last commit, or /dev/null for new files")
+	case "interpret-trailers":
+		fmt.Println("Usage: fool interpret-trailers [--parse] [--file <file>] [options]\n  Print the trailer lines (e.g. 'Fixes: #12') of a message read from stdin or --file.\n  --parse             Print only the trailers, one per line\n  --only-trailers     Omit the message body\n  --separator=<sep>   Separator between key and value (default ':')\n  --trim-empty        Skip trailers with empty values\n  --json              Print each trailer as a JSON object")
 	case "version":
 		fmt.Println("Usage: fool version\n  Show fool version.")
 	default:
@@ -66,79 +181,255 @@ func cmdVersion() {
 	fmt.Printf("fool version %s\n", foolVersion)
 }
 
-func cmdInit() {
-	dir := ".fool"
+func cmdInit(args []string) {
+	root := "."
+	if len(args) > 1 {
+		fmt.Println("Usage: fool init [<directory>]")
+		os.Exit(1)
+	}
+	if len(args) == 1 {
+		root = args[0]
+	}
+	dir := filepath.Join(root, ".fool")
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
 	if _, err := os.Stat(dir); err == nil {
 		fmt.Println("Repository already initialized.")
 		return
 	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		fmt.Println("Error creating directory:", err)
+		os.Exit(1)
+	}
 	err := os.Mkdir(dir, 0755)
+	if err == nil {
+		err = initRepoLayout(dir)
+	}
 	if err != nil {
 		fmt.Println("Error initializing repository:", err)
 		os.Exit(1)
 	}
-	fmt.Println("Initialized empty fool repository in .fool/")
+	fmt.Printf("Initialized empty fool repository in %s%c\n", dir, filepath.Separator)
+}
+
+// initRepoLayout fills a new .fool directory with an empty object store, a
+// HEAD on branch main and a minimal config.
+func initRepoLayout(dir string) error {
+	for _, sub := range []string{"objects", filepath.Join("refs", "heads"), filepath.Join("refs", "tags")} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "config"), []byte("[core]\n\trepositoryformatversion = 0\n"), 0644)
 }
 
 func cmdAdd(args []string) {
 	ensureRepo()
-	if len(args) < 1 {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	var verbose, dryRun, update, force bool
+	fs.BoolVar(&verbose, "v", false, "show a line count summary for each file")
+	fs.BoolVar(&verbose, "verbose", false, "show a line count summary for each file")
+	fs.BoolVar(&dryRun, "n", false, "only show what would be staged")
+	fs.BoolVar(&dryRun, "dry-run", false, "only show what would be staged")
+	fs.BoolVar(&update, "u", false, "stage changes and deletions of tracked files only")
+	fs.BoolVar(&update, "update", false, "stage changes and deletions of tracked files only")
+	fs.BoolVar(&force, "f", false, "add files even if .foolignore matches them")
+	fs.BoolVar(&force, "force", false, "add files even if .foolignore matches them")
+	fs.Parse(args)
+	args = fs.Args()
+	if update && len(args) > 0 {
+		fmt.Println("Usage: fool add -u")
+		return
+	}
+	if len(args) < 1 && !update {
 		fmt.Println("Usage: fool add <file> [<file> ...]")
 		return
 	}
-	indexPath := ".fool/index"
-	var staged []string
-	stagedMap := map[string]bool{}
-	if data, err := os.ReadFile(indexPath); err == nil {
-		lines := string(data)
-		for _, line := range splitLines(lines) {
-			if line != "" {
-				staged = append(staged, line)
-				stagedMap[line] = true
+	var patterns []string
+	if !force {
+		patterns = parseIgnorePatterns(".foolignore")
+	}
+	// "fool add ." and "fool add -u" stage many files and only print a
+	// summary.
+	addAll := update || len(args) == 1 && args[0] == "."
+	var deletions []string
+	if update {
+		args, deletions = trackedChanges()
+	} else if addAll {
+		args = collectWorkingFiles(".", patterns)
+	} else {
+		var ignored []string
+		args, ignored = dropIgnored(expandDirs(expandGlobs(args, patterns), patterns), patterns)
+		if len(ignored) > 0 {
+			fmt.Printf("The following paths are ignored by .foolignore: %s. Use --force if you really want to add them.\n",
+				strings.Join(ignored, ", "))
+			// The other files are still staged, but the command fails.
+			defer os.Exit(1)
+		}
+	}
+	addedCount := 0
+	stage := func(staged []string) []string {
+		stagedMap := map[string]bool{}
+		for _, line := range staged {
+			stagedMap[line] = true
+		}
+		for _, file := range deletions {
+			if stagedMap[deleteMarker+file] {
+				continue
+			}
+			staged = append(removeString(staged, file), deleteMarker+file)
+			stagedMap[deleteMarker+file] = true
+			if dryRun {
+				fmt.Printf("would remove: %s\n", file)
+			}
+			addedCount++
+		}
+		for _, file := range args {
+			if _, err := os.Stat(file); err != nil {
+				fmt.Printf("File '%s' does not exist.\n", file)
+				continue
+			}
+			if stagedMap[file] {
+				if !addAll {
+					fmt.Printf("File '%s' is already staged.\n", file)
+				}
+				continue
+			}
+			if stagedMap[deleteMarker+file] {
+				// Re-adding a removed file cancels the pending deletion.
+				staged = removeString(staged, deleteMarker+file)
+				delete(stagedMap, deleteMarker+file)
+			}
+			staged = append(staged, file)
+			stagedMap[file] = true
+			if dryRun {
+				fmt.Printf("would add: %s\n", file)
+			} else if !addAll {
+				fmt.Printf("Added '%s' to staging area.\n", file)
+			}
+			if verbose {
+				printAddStat(file)
 			}
+			addedCount++
 		}
+		// Deduplicate staged list before writing
+		unique := map[string]struct{}{}
+		var deduped []string
+		for _, s := range staged {
+			if _, ok := unique[s]; !ok {
+				unique[s] = struct{}{}
+				deduped = append(deduped, s)
+			}
+		}
+		return deduped
 	}
-	addedAny := false
-	for _, file := range args {
-		if _, err := os.Stat(file); err != nil {
-			fmt.Printf("File '%s' does not exist.\n", file)
-			continue
+	if dryRun {
+		stage(readIndex())
+		if addedCount == 0 {
+			fmt.Println("No new files would be added to the staging area.")
+		}
+		return
+	}
+	// The index is re-read under the lock so concurrent adds are not lost.
+	if err := updateIndex(stage); err != nil {
+		fmt.Println("Error updating index:", err)
+		os.Exit(1)
+	}
+	if addedCount == 0 {
+		fmt.Println("No new files were added to the staging area.")
+	} else if addAll {
+		fmt.Printf("Staged %d file(s).\n", addedCount)
+	}
+}
+
+// trackedChanges returns the files of the HEAD commit that differ in the
+// working directory and those that were deleted from it, both sorted.
+func trackedChanges() (modified, deleted []string) {
+	files, commitID := getLastCommitFilesAndID()
+	for f := range files {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			deleted = append(deleted, f)
+		}
+	}
+	sort.Strings(deleted)
+	return modifiedFiles(files, commitID), deleted
+}
+
+// dropIgnored splits files into those .foolignore allows and those it
+// matches.
+func dropIgnored(files []string, patterns []string) (kept, ignored []string) {
+	for _, f := range files {
+		if isIgnored(filepath.ToSlash(filepath.Clean(f)), patterns) {
+			ignored = append(ignored, f)
+		} else {
+			kept = append(kept, f)
 		}
-		if stagedMap[file] {
-			fmt.Printf("File '%s' is already staged.\n", file)
+	}
+	return kept, ignored
+}
+
+// expandDirs replaces directory arguments with the non-ignored files under
+// them, so the index only ever holds file paths.
+func expandDirs(args []string, patterns []string) []string {
+	var out []string
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			out = append(out, collectWorkingFiles(arg, patterns)...)
 			continue
 		}
-		staged = append(staged, file)
-		stagedMap[file] = true
-		fmt.Printf("Added '%s' to staging area.\n", file)
-		addedAny = true
+		out = append(out, arg)
 	}
-	// Deduplicate staged list before writing
-	unique := map[string]struct{}{}
-	var deduped []string
-	for _, s := range staged {
-		if s == "" {
+	return out
+}
+
+// expandGlobs replaces arguments that name no file but contain glob
+// characters, as when the shell did not expand them, with the non-ignored
+// files they match. Arguments matching nothing are kept so they are
+// reported as missing.
+func expandGlobs(args []string, patterns []string) []string {
+	var out []string
+	for _, arg := range args {
+		if _, err := os.Stat(arg); err == nil || !strings.ContainsAny(arg, "*?[") {
+			out = append(out, arg)
 			continue
 		}
-		if _, ok := unique[s]; !ok {
-			unique[s] = struct{}{}
-			deduped = append(deduped, s)
+		matches, _ := filepath.Glob(arg)
+		found := false
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil || info.IsDir() || isIgnored(filepath.ToSlash(m), patterns) {
+				continue
+			}
+			out = append(out, filepath.ToSlash(m))
+			found = true
+		}
+		if !found {
+			out = append(out, arg)
 		}
 	}
-	f, err := os.OpenFile(indexPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	return out
+}
+
+// printAddStat prints how a file being staged differs from its last
+// committed version.
+func printAddStat(file string) {
+	newData, err := os.ReadFile(file)
 	if err != nil {
-		fmt.Println("Error updating index:", err)
 		return
 	}
-	for _, s := range deduped {
-		fmt.Fprintln(f, s)
-	}
-	if err := f.Close(); err != nil {
-		fmt.Println("Error closing index file:", err)
-	}
-	if !addedAny {
-		fmt.Println("No new files were added to the staging area.")
+	lastCommitFiles, lastCommitID := getLastCommitFilesAndID()
+	if lastCommitFiles[file] {
+		if oldData, err := os.ReadFile(filepath.Join(".fool", "objects", lastCommitID, file)); err == nil {
+			added, removed := computeDiffStat(oldData, newData)
+			fmt.Printf("  modified: %s (+%d, -%d lines)\n", file, added, removed)
+			return
+		}
 	}
+	fmt.Printf("  new file: %s (%d lines)\n", file, len(splitContentLines(newData)))
 }
 
 func splitLines(s string) []string {
@@ -154,20 +445,211 @@ func cmdCommit(args []string) {
 	ensureRepo()
 	fs := flag.NewFlagSet("commit", flag.ExitOnError)
 	msg := fs.String("m", "", "commit message")
+	var msgFile string
+	fs.StringVar(&msgFile, "F", "", "read the commit message from this file (- for stdin)")
+	fs.StringVar(&msgFile, "file", "", "read the commit message from this file (- for stdin)")
+	var reuse, reedit string
+	fs.StringVar(&reuse, "C", "", "reuse the message of the given commit")
+	fs.StringVar(&reuse, "reuse-message", "", "reuse the message of the given commit")
+	fs.StringVar(&reedit, "c", "", "like -C, but open an editor on the message")
+	fs.StringVar(&reedit, "reedit-message", "", "like -C, but open an editor on the message")
+	only := fs.Bool("only", false, "commit only the given paths, keeping other staged files")
+	exclude := fs.Bool("exclude", false, "commit all staged files except the given paths")
+	config := loadConfig()
+	var signoff bool
+	fs.BoolVar(&signoff, "s", configBool(config["commit.signoff"]), "add a Signed-off-by trailer")
+	fs.BoolVar(&signoff, "signoff", configBool(config["commit.signoff"]), "add a Signed-off-by trailer")
+	noSignoff := fs.Bool("no-signoff", false, "do not add a Signed-off-by trailer, even if commit.signOff is set")
+	author := fs.String("author", "", "override the commit author, as \"Name <email>\"")
+	amend := fs.Bool("amend", false, "replace the last commit")
+	var all bool
+	fs.BoolVar(&all, "a", false, "also commit every modified tracked file")
+	fs.BoolVar(&all, "all", false, "also commit every modified tracked file")
 	fs.Parse(args)
+	paths := fs.Args()
+	if all && len(paths) > 0 {
+		fmt.Println("Error: paths cannot be combined with -a.")
+		return
+	}
+	if *only && *exclude {
+		fmt.Println("Error: options --only and --exclude cannot be used together.")
+		return
+	}
+	if (*only || *exclude) && len(paths) == 0 {
+		fmt.Println("Error: --only and --exclude need at least one path.")
+		return
+	}
+	if reuse != "" && reedit != "" {
+		fmt.Println("Error: options -C and -c cannot be used together.")
+		return
+	}
+	if *msg != "" && (reuse != "" || reedit != "") {
+		fmt.Println("Error: option -m cannot be combined with -C or -c.")
+		return
+	}
+	if msgFile != "" {
+		if *msg != "" || reuse != "" || reedit != "" {
+			fmt.Println("Error: option -F cannot be combined with -m, -C or -c.")
+			return
+		}
+		var data []byte
+		var err error
+		if msgFile == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(msgFile)
+		}
+		if err != nil {
+			fmt.Println("Error reading commit message:", err)
+			return
+		}
+		if strings.TrimSpace(string(data)) == "" {
+			fmt.Println("Aborting commit due to empty commit message.")
+			return
+		}
+		*msg = strings.TrimRight(string(data), "\r\n")
+	}
+	if src := reuse + reedit; src != "" {
+		prev, err := readCommitMessage(src)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		*msg = prev
+		if reedit != "" {
+			edited, err := editMessage(prev)
+			if err != nil {
+				fmt.Println("Error running editor:", err)
+				return
+			}
+			if edited == "" {
+				fmt.Println("Aborting commit due to empty commit message.")
+				return
+			}
+			*msg = edited
+		}
+	}
+	// --amend replaces the HEAD commit, keeping its message unless a new one
+	// is given.
+	var amended *CommitMeta
+	if *amend {
+		head := headCommitID()
+		if head == "" {
+			fmt.Println("Error: there is no commit to amend.")
+			return
+		}
+		var err error
+		if amended, err = loadCommit(head); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if *msg == "" {
+			*msg = amended.Message
+		}
+	}
 	if *msg == "" {
 		fmt.Println("Usage: fool commit -m <message>")
 		return
 	}
-	indexPath := ".fool/index"
-	data, err := os.ReadFile(indexPath)
-	if err != nil || len(data) == 0 {
+	// Sign-offs always use the configured identity, even with --author.
+	authorName, authorEmail := resolveAuthor(config)
+	if signoff && !*noSignoff {
+		*msg = signOff(*msg, fmt.Sprintf("%s <%s>", authorName, authorEmail))
+	}
+	if *author != "" {
+		name, email, ok := parseIdent(*author)
+		if !ok {
+			fmt.Println("Error: --author must look like \"Name <email>\".")
+			return
+		}
+		authorName, authorEmail = name, email
+	}
+	var staged, deletions, renames []string
+	for _, line := range readIndex() {
+		if strings.HasPrefix(line, deleteMarker) {
+			deletions = append(deletions, line[len(deleteMarker):])
+		} else if strings.HasPrefix(line, renameMarker) {
+			renames = append(renames, line)
+		} else {
+			staged = append(staged, line)
+		}
+	}
+	// -a stages modified tracked files for this commit only; the index file
+	// is left alone until the commit has been written.
+	if all {
+		headFiles, headID := getLastCommitFilesAndID()
+		for _, f := range modifiedFiles(headFiles, headID) {
+			if !containsString(staged, f) && !containsString(deletions, f) {
+				staged = append(staged, f)
+			}
+		}
+	}
+	// With --only/--exclude the index is split into the files committed now
+	// and the ones kept staged for a later commit.
+	files := staged
+	var keep, deleted []string
+	for _, d := range deletions {
+		listed := containsString(paths, d)
+		if (*only && !listed) || (*exclude && listed) {
+			keep = append(keep, deleteMarker+d)
+			continue
+		}
+		deleted = append(deleted, d)
+	}
+	if *only {
+		selected, rest := selectPaths(staged, paths)
+		keep = append(keep, rest...)
+		files = nil
+		for _, p := range selected {
+			if containsString(deleted, p) {
+				continue
+			}
+			if !containsString(staged, p) {
+				fmt.Printf("Warning: '%s' was not staged; staging it for this commit.\n", p)
+			}
+			files = append(files, p)
+		}
+	} else if *exclude {
+		var excluded []string
+		excluded, files = selectPaths(staged, paths)
+		for _, p := range excluded {
+			if containsString(staged, p) {
+				keep = append(keep, p)
+			}
+		}
+	}
+	// A rename commits the new path from the working directory and drops the
+	// old one from the snapshot.
+	var renamed []string
+	for _, r := range renames {
+		src, dst, _ := parseRename(r)
+		listed := containsString(paths, src) || containsString(paths, dst)
+		if (*only && !listed) || (*exclude && listed) {
+			keep = append(keep, r)
+			continue
+		}
+		renamed = append(renamed, src+"->"+dst)
+		if !containsString(files, dst) {
+			files = append(files, dst)
+		}
+	}
+	// A merge in progress is concluded by this commit, even if the merge
+	// left nothing to stage.
+	mergeHead := ""
+	if !*amend {
+		if data, err := os.ReadFile(mergeHeadPath()); err == nil {
+			mergeHead = strings.TrimSpace(string(data))
+		}
+	}
+	if len(files) == 0 && len(deleted) == 0 && !*amend && mergeHead == "" {
 		fmt.Println("Nothing to commit. Staging area is empty.")
 		return
 	}
-	files := splitLines(string(data))
-	commitTime := time.Now().UTC().Format(time.RFC3339)
-	commitID := genCommitID(commitTime, *msg)
+	// When amending, the commit being replaced is the base of the new
+	// snapshot, which therefore keeps that commit's changes.
+	parentFiles, parentID := getLastCommitFilesAndID()
+	commitTime := time.Now().UTC().Truncate(time.Second)
+	commitID := genCommitIDv2(commitTime.Format(time.RFC3339), *msg)
 	commitDir := filepath.Join(".fool", "objects", commitID)
 	if err := os.MkdirAll(commitDir, 0755); err != nil {
 		fmt.Println("Error creating commit directory:", err)
@@ -178,223 +660,1321 @@ func cmdCommit(args []string) {
 		if file == "" {
 			continue
 		}
-		in, err := os.Open(file)
-		if err != nil {
-			fmt.Printf("Warning: could not open '%s', skipping.\n", file)
+		if err := copyFileToCommit(file, filepath.Join(commitDir, file)); err != nil {
+			if os.IsNotExist(err) {
+				fmt.Printf("Warning: could not open '%s', skipping.\n", file)
+			} else {
+				fmt.Printf("Warning: could not copy '%s' (%v), skipping.\n", file, err)
+			}
 			continue
 		}
-		defer in.Close()
-		outPath := filepath.Join(commitDir, file)
-		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
-			fmt.Printf("Warning: could not create directory for '%s', skipping.\n", file)
-			in.Close()
+		committedFiles = append(committedFiles, file)
+	}
+	if len(committedFiles) == 0 && len(deleted) == 0 && !*amend && mergeHead == "" {
+		fmt.Println("No files were committed.")
+		return
+	}
+	// Each commit directory holds a full snapshot of the tracked files, so
+	// carry over everything from the previous commit that wasn't restaged.
+	committedSet := map[string]bool{}
+	for _, f := range committedFiles {
+		committedSet[filepath.ToSlash(filepath.Clean(f))] = true
+	}
+	for _, f := range deleted {
+		committedSet[filepath.ToSlash(filepath.Clean(f))] = true
+	}
+	for _, r := range renamed {
+		src, _, _ := strings.Cut(r, "->")
+		committedSet[src] = true
+	}
+	for f := range parentFiles {
+		if committedSet[f] {
 			continue
 		}
-		out, err := os.Create(outPath)
-		if err != nil {
-			fmt.Printf("Warning: could not write '%s', skipping.\n", file)
-			in.Close()
-			continue
+		if err := copyFileToCommit(filepath.Join(".fool", "objects", parentID, f), filepath.Join(commitDir, f)); err != nil {
+			fmt.Printf("Error carrying over '%s' from the previous commit: %v\n", f, err)
+			return
 		}
-		defer out.Close()
-		if _, err := io.Copy(out, in); err != nil {
-			fmt.Printf("Warning: could not copy '%s', skipping.\n", file)
-			continue
+	}
+	// The new commit's parent is HEAD, or when amending, HEAD's parents.
+	parent := parentID
+	if *amend {
+		committedFiles, deleted = mergeAmendedFiles(amended, committedFiles, deleted)
+		renamed = append(amended.Renamed, renamed...)
+		parent = amended.Parent
+		if mergeHead == "" {
+			mergeHead = amended.MergeParent
 		}
-		committedFiles = append(committedFiles, file)
 	}
-	if len(committedFiles) == 0 {
-		fmt.Println("No files were committed.")
-		return
+	commit := &CommitMeta{
+		ID:          commitID,
+		Parent:      parent,
+		MergeParent: mergeHead,
+		AuthorName:  authorName,
+		AuthorEmail: authorEmail,
+		Date:        commitTime,
+		Message:     *msg,
+		Files:       committedFiles,
+		Deleted:     deleted,
+		Renamed:     renamed,
 	}
-	meta := fmt.Sprintf("commit: %s\ndate: %s\nmessage: %s\nfiles: %v\n", commitID, commitTime, *msg, committedFiles)
-	if err := os.WriteFile(filepath.Join(commitDir, "meta.txt"), []byte(meta), 0644); err != nil {
+	if err := os.WriteFile(filepath.Join(commitDir, "meta.txt"), []byte(commit.metaText()), 0644); err != nil {
 		fmt.Println("Error writing commit metadata:", err)
 		return
 	}
 	// Append to log
-	logEntry := fmt.Sprintf("commit %s\nDate: %s\nMessage: %s\nFiles: %v\n\n", commitID, commitTime, *msg, committedFiles)
-	f, err := os.OpenFile(".fool/log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Println("Error writing to log:", err)
-		return
+	logEntry := commit.logEntry() + "\n"
+	if *amend {
+		// The replaced commit's object stays: the reflog, branches and tags
+		// may still name it, and fool gc removes it once nothing does.
+		if err := replaceLogEntry(parentID, logEntry); err != nil {
+			fmt.Println("Error writing log entry:", err)
+			return
+		}
+	} else {
+		f, err := os.OpenFile(".fool/log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Println("Error writing to log:", err)
+			return
+		}
+		defer f.Close()
+		if _, err := f.WriteString(logEntry); err != nil {
+			fmt.Println("Error writing log entry:", err)
+			return
+		}
 	}
-	defer f.Close()
-	if _, err := f.WriteString(logEntry); err != nil {
-		fmt.Println("Error writing log entry:", err)
+	if err := updateHEAD(commitID); err != nil {
+		fmt.Println("Error updating HEAD:", err)
 		return
 	}
-	// Clear index
-	if err := os.WriteFile(indexPath, []byte{}, 0644); err != nil {
+	action := "commit"
+	switch {
+	case *amend:
+		action = "commit (amend)"
+	case mergeHead != "":
+		action = "commit (merge)"
+	case parentID == "":
+		action = "commit (initial)"
+	}
+	appendReflog(parentID, commitID, action, commit.Subject())
+	// Clear index, keeping anything left out by --only/--exclude
+	if err := writeIndex(keep); err != nil {
 		fmt.Println("Error clearing index:", err)
 		return
 	}
+	if mergeHead != "" {
+		os.Remove(mergeHeadPath())
+	}
+	if *amend {
+		fmt.Printf("Amended commit %s; committed %d file(s) with id %s\n", parentID, len(committedFiles), commitID)
+		return
+	}
+	if len(deleted) > 0 {
+		fmt.Printf("Committed %d file(s) and %d deletion(s) with id %s\n", len(committedFiles), len(deleted), commitID)
+		return
+	}
 	fmt.Printf("Committed %d file(s) with id %s\n", len(committedFiles), commitID)
 }
 
-func genCommitID(ts, msg string) string {
-	h := sha1.New()
-	h.Write([]byte(ts + msg))
-	return fmt.Sprintf("%x", h.Sum(nil))[:8]
-}
-
-func cmdLog() {
-	ensureRepo()
-	logPath := ".fool/log"
-	data, err := os.ReadFile(logPath)
-	if err != nil || len(data) == 0 {
-		fmt.Println("No commits yet.")
-		return
+// readCommitMessage returns the message recorded in the meta.txt of the given commit.
+func readCommitMessage(commitID string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(".fool", "objects", commitID, "meta.txt"))
+	if err != nil {
+		return "", fmt.Errorf("unknown commit '%s'", commitID)
 	}
-	entries := splitLogEntries(string(data))
-	for i := len(entries) - 1; i >= 0; i-- {
-		if entries[i] != "" {
-			fmt.Println(entries[i])
+	lines := splitLines(string(data))
+	for i, line := range lines {
+		if strings.HasPrefix(line, "message: ") {
+			return decodeMessage(line[len("message: "):], lines[i+1:]), nil
 		}
 	}
+	return "", fmt.Errorf("commit '%s' has no message", commitID)
 }
 
-func splitLogEntries(s string) []string {
-	var entries []string
-	start := 0
-	for i := 0; i < len(s)-1; i++ {
-		if s[i] == '\n' && s[i+1] == '\n' {
-			entries = append(entries, s[start:i])
-			start = i + 2
-		}
+// readMeta parses a commit's meta.txt into its "key: value" fields, with
+// the message decoded back to its original lines.
+func readMeta(commitID string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(".fool", "objects", commitID, "meta.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown commit '%s'", commitID)
 	}
-	if start < len(s) {
-		entries = append(entries, s[start:])
+	meta := map[string]string{}
+	lines := splitLines(string(data))
+	for i, line := range lines {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok || strings.HasPrefix(line, messageIndent) {
+			continue
+		}
+		if key == "message" {
+			value = decodeMessage(value, lines[i+1:])
+		}
+		meta[key] = value
 	}
-	return entries
+	return meta, nil
 }
 
-func cmdStatus() {
-	ensureRepo()
-	// List staged files
-	indexPath := ".fool/index"
-	staged := map[string]bool{}
-	if data, err := os.ReadFile(indexPath); err == nil && len(data) > 0 {
-		for _, f := range splitLines(string(data)) {
-			if f != "" {
-				staged[f] = true
-			}
-		}
+// resolveCommitPrefix expands an abbreviated commit ID of at least four
+// characters to the full ID of the single commit it matches.
+func resolveCommitPrefix(prefix string) (string, error) {
+	if _, err := os.Stat(filepath.Join(".fool", "objects", prefix, "meta.txt")); err == nil {
+		return prefix, nil
 	}
-	if len(staged) > 0 {
-		fmt.Println("Staged files:")
-		for f := range staged {
-			fmt.Println("  ", f)
-		}
-	} else {
-		fmt.Println("No files staged for commit.")
+	if len(prefix) < 4 {
+		return "", fmt.Errorf("commit ID '%s' is too short; use at least 4 characters", prefix)
 	}
-
-	// List untracked files (in project root, not staged, not in last commit)
-	files, _ := os.ReadDir(".")
-	lastCommitFiles, lastCommitID := getLastCommitFilesAndID()
-	untracked := []string{}
-	for _, file := range files {
-		name := file.Name()
-		if file.IsDir() || name == ".fool" || name == ".git" {
+	dirs, _ := os.ReadDir(filepath.Join(".fool", "objects"))
+	var matches []string
+	for _, d := range dirs {
+		if !d.IsDir() || !strings.HasPrefix(d.Name(), prefix) {
 			continue
 		}
-		if !staged[name] && !lastCommitFiles[name] {
-			untracked = append(untracked, name)
+		if _, err := os.Stat(filepath.Join(".fool", "objects", d.Name(), "meta.txt")); err == nil {
+			matches = append(matches, d.Name())
 		}
 	}
-	if len(untracked) > 0 {
-		fmt.Println("Untracked files:")
-		for _, f := range untracked {
-			fmt.Println("  ", f)
-		}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("unknown commit '%s'", prefix)
+	case 1:
+		return matches[0], nil
 	}
+	return "", fmt.Errorf("commit ID '%s' is ambiguous", prefix)
+}
 
-	// Show modified files (in last commit, not staged, and contents differ)
-	modified := []string{}
-	for f := range lastCommitFiles {
-		if staged[f] {
-			continue // staged files already shown
+// previousCommitID returns the commit logged just before commitID, or "" if
+// it is the first one.
+func previousCommitID(commitID string) string {
+	data, err := os.ReadFile(".fool/log")
+	if err != nil {
+		return ""
+	}
+	prev := ""
+	for _, entry := range splitLogEntries(string(data)) {
+		id := logEntryField(entry, "commit ")
+		if id == commitID {
+			return prev
 		}
-		wdData, err1 := os.ReadFile(f)
-		commitData, err2 := os.ReadFile(filepath.Join(".fool", "objects", lastCommitID, f))
-		if err1 == nil && err2 == nil && string(wdData) != string(commitData) {
-			modified = append(modified, f)
+		prev = id
+	}
+	return ""
+}
+
+// encodeMessage indents every line after the first so a multi-line message
+// stays inside its meta.txt field and never produces the blank line that
+// separates entries in .fool/log.
+func encodeMessage(msg string) string {
+	return strings.ReplaceAll(msg, "\n", "\n"+messageIndent)
+}
+
+// decodeMessage reverses encodeMessage given the first line of the message
+// and the lines that follow it.
+func decodeMessage(first string, rest []string) string {
+	msg := first
+	for _, line := range rest {
+		if !strings.HasPrefix(line, messageIndent) {
+			break
 		}
+		msg += "\n" + line[len(messageIndent):]
 	}
-	if len(modified) > 0 {
-		fmt.Println("Modified files:")
-		for _, f := range modified {
-			fmt.Println("  ", f)
+	return msg
+}
+
+// signOff appends a Signed-off-by trailer for signer to msg unless the
+// message already ends with the same one.
+func signOff(msg, signer string) string {
+	line := "Signed-off-by: " + signer
+	_, trailers := parseTrailers(msg, ":")
+	if n := len(trailers); n > 0 {
+		last := trailers[n-1]
+		if strings.EqualFold(last.Key, "Signed-off-by") && last.Value == signer {
+			return msg
 		}
+		return strings.TrimRight(msg, "\n") + "\n" + line
 	}
+	return strings.TrimRight(msg, "\n") + "\n\n" + line
 }
 
-func getLastCommitFilesAndID() (map[string]bool, string) {
-	logPath := ".fool/log"
-	data, err := os.ReadFile(logPath)
-	if err != nil || len(data) == 0 {
-		return map[string]bool{}, ""
+// editMessage opens the user's editor on initial and returns the edited
+// message with comment lines removed. The editor is taken from FOOL_EDITOR,
+// VISUAL or EDITOR, in that order, falling back to vi.
+func editMessage(initial string) (string, error) {
+	editor := os.Getenv("FOOL_EDITOR")
+	if editor == "" {
+		editor = os.Getenv("VISUAL")
 	}
-	entries := splitLogEntries(string(data))
-	if len(entries) == 0 {
-		return map[string]bool{}, ""
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
 	}
-	last := entries[len(entries)-1]
-	files := map[string]bool{}
-	var commitID string
-	for _, line := range splitLines(last) {
-		if len(line) > 7 && line[:7] == "Files: " {
-			var fname string
-			for _, v := range line[7:] {
-				if v != '[' && v != ']' && v != ' ' && v != ',' {
-					fname += string(v)
-				} else if fname != "" {
-					files[fname] = true
-					fname = ""
-				}
-			}
-			if fname != "" {
-				files[fname] = true
-			}
-		}
-		if len(line) > 7 && line[:7] == "commit " {
-			commitID = line[7:]
+	if editor == "" {
+		editor = "vi"
+	}
+	path := filepath.Join(".fool", "COMMIT_EDITMSG")
+	content := initial + "\n\n# Please enter the commit message for your changes. Lines starting\n# with '#' will be ignored, and an empty message aborts the commit.\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var kept []string
+	for _, line := range splitLines(string(data)) {
+		if strings.HasPrefix(line, "#") {
+			continue
 		}
+		kept = append(kept, strings.TrimRight(line, " \t"))
 	}
-	return files, commitID
+	return strings.TrimSpace(strings.Join(kept, "\n")), nil
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		printUsage()
-		return
+// copyFileToCommit copies src to dst, creating dst's parent directories.
+// Both files are closed before it returns, so it is safe to call in a loop.
+func copyFileToCommit(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
 	}
-
-	cmd := os.Args[1]
-	args := os.Args[2:]
-
-	// Global help/version
-	if cmd == "--help" || cmd == "-h" {
-		printUsage()
-		return
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		in.Close()
+		return err
 	}
-	if cmd == "version" {
-		cmdVersion()
-		return
+	out, err := os.Create(dst)
+	if err != nil {
+		in.Close()
+		return err
 	}
-	if cmd == "help" {
-		cmdHelp(args)
-		return
+	_, err = io.Copy(out, in)
+	in.Close()
+	if cerr := out.Close(); err == nil {
+		err = cerr
 	}
+	return err
+}
 
-	switch cmd {
-	case "init":
-		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
-			printCommandHelp("init")
-			return
+// snapshotFiles lists the files stored in a commit's object directory as
+// slash-separated paths relative to it, excluding meta.txt.
+func snapshotFiles(commitID string) []string {
+	if commitID == "" {
+		return nil
+	}
+	root := filepath.Join(".fool", "objects", commitID)
+	var files []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
 		}
-		cmdInit()
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if rel != "meta.txt" {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// mergeAmendedFiles combines the file and deletion lists of the commit being
+// amended with those staged now. A later change to a path wins over an
+// earlier one, so re-adding a deleted file drops it from the deletions.
+func mergeAmendedFiles(amended *CommitMeta, files, deleted []string) ([]string, []string) {
+	var mergedFiles, mergedDeleted []string
+	for _, f := range amended.Files {
+		if !containsString(files, f) && !containsString(deleted, f) {
+			mergedFiles = append(mergedFiles, f)
+		}
+	}
+	for _, f := range amended.Deleted {
+		if !containsString(files, f) && !containsString(deleted, f) {
+			mergedDeleted = append(mergedDeleted, f)
+		}
+	}
+	return append(mergedFiles, files...), append(mergedDeleted, deleted...)
+}
+
+// replaceLogEntry overwrites the .fool/log entry of commitID with entry, or
+// removes it if entry is empty.
+func replaceLogEntry(commitID, entry string) error {
+	data, err := os.ReadFile(".fool/log")
+	if err != nil {
+		return err
+	}
+	var content string
+	for _, e := range splitLogEntries(string(data)) {
+		if logEntryField(e, "commit ") == commitID {
+			content += entry
+			continue
+		}
+		content += e + "\n\n"
+	}
+	return os.WriteFile(".fool/log", []byte(content), 0644)
+}
+
+// selectPaths returns the given paths (in order, without duplicates) and the
+// staged entries that are not among them.
+func selectPaths(staged, paths []string) (selected, rest []string) {
+	for _, p := range paths {
+		p = filepath.ToSlash(filepath.Clean(p))
+		if !containsString(selected, p) {
+			selected = append(selected, p)
+		}
+	}
+	for _, s := range staged {
+		if !containsString(selected, s) {
+			rest = append(rest, s)
+		}
+	}
+	return selected, rest
+}
+
+// removeString returns list without any occurrences of s.
+func removeString(list []string, s string) []string {
+	var out []string
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// genCommitIDv2 derives a full 64-character SHA-256 commit ID from the commit
+// time and message. A random nonce is mixed in so commits made in the same
+// second with the same message still get distinct IDs. Repositories started
+// before it keep their 8-character SHA-1 IDs, which resolve like any prefix.
+func genCommitIDv2(ts, msg string) string {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	h := sha256.New()
+	h.Write([]byte(ts + msg))
+	h.Write(nonce)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// defaultAbbrev is how many characters of a commit ID are displayed unless
+// asked otherwise.
+const defaultAbbrev = 8
+
+// abbrevID shortens id to n characters; n <= 0 keeps the full ID.
+func abbrevID(id string, n int) string {
+	if n <= 0 || n >= len(id) {
+		return id
+	}
+	return id[:n]
+}
+
+func cmdLog(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("log", flag.ExitOnError)
+	dateFormat := fs.String("date", "", "date style: relative, local, short, iso, iso-strict, rfc2822, unix or format:<strftime>")
+	var maxCount int
+	fs.IntVar(&maxCount, "n", 0, "show at most this many commits")
+	fs.IntVar(&maxCount, "max-count", 0, "show at most this many commits")
+	oneline := fs.Bool("oneline", os.Getenv("FOOL_LOG_FORMAT") == "oneline", "show each commit on a single line")
+	var greps stringList
+	fs.Var(&greps, "grep", "show only commits whose message matches this regexp (repeatable)")
+	allMatch := fs.Bool("all-match", false, "require every --grep pattern to match")
+	var authors stringList
+	fs.Var(&authors, "author", "show only commits whose author name or email matches this regexp (repeatable)")
+	ignoreCase := fs.Bool("i", false, "match --grep and --author patterns case-insensitively")
+	stat := fs.Bool("stat", false, "summarize the lines changed in each file")
+	abbrev := fs.Int("abbrev", defaultAbbrev, "show this many characters of each commit ID (0 for all)")
+	patch := fs.Bool("p", false, "show the diff each commit introduced")
+	fs.BoolVar(patch, "patch", false, "show the diff each commit introduced")
+	reverse := fs.Bool("reverse", false, "show the oldest commits first")
+	format := fs.String("format", "", "print each commit with this text/template, or oneline, full or fuller")
+	fs.Parse(expandCountShorthand(args))
+	if !validDateFormat(*dateFormat) {
+		fmt.Printf("Error: unknown date format '%s'\n", *dateFormat)
+		os.Exit(1)
+	}
+	var tmpl *template.Template
+	if *format != "" {
+		var err error
+		if tmpl, err = parseLogFormat(*format, *dateFormat); err != nil {
+			fmt.Println("Error: invalid --format template:", err)
+			os.Exit(1)
+		}
+	}
+	var patterns []*regexp.Regexp
+	for _, g := range greps {
+		if *ignoreCase {
+			g = "(?i)" + g
+		}
+		re, err := regexp.Compile(g)
+		if err != nil {
+			fmt.Printf("Error: invalid --grep pattern: %v\n", err)
+			os.Exit(1)
+		}
+		patterns = append(patterns, re)
+	}
+	var authorPatterns []*regexp.Regexp
+	for _, a := range authors {
+		// A pattern that is not a valid regexp is matched as a plain string.
+		re, err := regexp.Compile(a)
+		if err != nil {
+			re = regexp.MustCompile(regexp.QuoteMeta(a))
+		}
+		if *ignoreCase {
+			re = regexp.MustCompile("(?i)" + re.String())
+		}
+		authorPatterns = append(authorPatterns, re)
+	}
+	commits := commitHistory(headCommitID())
+	if len(commits) == 0 {
+		fmt.Println("No commits yet.")
+		return
+	}
+	if fs.NArg() > 0 {
+		file := filepath.ToSlash(filepath.Clean(fs.Arg(0)))
+		commits = commitsForFile(commits, file)
+		if len(commits) == 0 {
+			fmt.Printf("No commits found for '%s'\n", file)
+			return
+		}
+	}
+	if len(patterns) > 0 {
+		commits = filterCommitsByMessage(commits, patterns, *allMatch)
+	}
+	if len(authorPatterns) > 0 {
+		commits = filterCommitsByAuthor(commits, authorPatterns)
+	}
+	commits = orderCommits(commits, *reverse)
+	if maxCount > 0 && maxCount < len(commits) {
+		commits = commits[:maxCount]
+	}
+	tags := tagsByCommit()
+	for _, c := range commits {
+		if tmpl != nil {
+			var b strings.Builder
+			if err := tmpl.Execute(&b, c); err != nil {
+				fmt.Println("Error: invalid --format template:", err)
+				os.Exit(1)
+			}
+			fmt.Println(b.String())
+		} else if *oneline {
+			fmt.Printf("%s%s %s\n", colorize(colorYellow, abbrevID(c.ID, *abbrev)), decoration(tags[c.ID]), c.Subject())
+		} else {
+			entry := c.logEntry()
+			if *stat {
+				// The stat block replaces the raw file lists.
+				entry = strings.Split(entry, "\nFiles: ")[0]
+			}
+			entry = strings.TrimSuffix(entry, "\n")
+			entry = strings.Replace(entry, "commit "+c.ID, "commit "+colorize(colorYellow, abbrevID(c.ID, *abbrev))+decoration(tags[c.ID]), 1)
+			fmt.Println(colorLogDate(reformatLogDate(entry, *dateFormat)))
+		}
+		if *stat {
+			if stats := commitStat(c.Parent, c.ID); len(stats) > 0 {
+				fmt.Print(formatStat(stats))
+			}
+		}
+		if *patch {
+			fmt.Print(colorDiff(commitPatch(c.Parent, c.ID)))
+		}
+	}
+}
+
+// orderCommits returns commits, which are newest first, in display order:
+// unchanged, or oldest first if reverse is set.
+func orderCommits(commits []*CommitMeta, reverse bool) []*CommitMeta {
+	if !reverse {
+		return commits
+	}
+	ordered := make([]*CommitMeta, len(commits))
+	for i, c := range commits {
+		ordered[len(commits)-1-i] = c
+	}
+	return ordered
+}
+
+// filterCommitsByMessage keeps the commits whose message matches any of
+// patterns, or all of them if allMatch is set.
+func filterCommitsByMessage(commits []*CommitMeta, patterns []*regexp.Regexp, allMatch bool) []*CommitMeta {
+	var matches []*CommitMeta
+	for _, c := range commits {
+		hits := 0
+		for _, re := range patterns {
+			if re.MatchString(c.Message) {
+				hits++
+			}
+		}
+		if (allMatch && hits == len(patterns)) || (!allMatch && hits > 0) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// filterCommitsByAuthor keeps the commits whose author name or email
+// matches any of patterns.
+func filterCommitsByAuthor(commits []*CommitMeta, patterns []*regexp.Regexp) []*CommitMeta {
+	var matches []*CommitMeta
+	for _, c := range commits {
+		for _, re := range patterns {
+			if re.MatchString(c.AuthorName) || re.MatchString(c.AuthorEmail) {
+				matches = append(matches, c)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// stringList is a flag.Value collecting every use of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// commitsForFile returns, in their original order, the commits that added,
+// changed, deleted or renamed filename.
+func commitsForFile(commits []*CommitMeta, filename string) []*CommitMeta {
+	var matches []*CommitMeta
+	for _, c := range commits {
+		files := append(append([]string{}, c.Files...), c.Deleted...)
+		for _, r := range c.Renamed {
+			src, _, _ := strings.Cut(r, "->")
+			files = append(files, src)
+		}
+		for _, f := range files {
+			if filepath.ToSlash(filepath.Clean(f)) == filename {
+				matches = append(matches, c)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// parseFileList parses a file list written with %v, such as "[a.txt b.txt]".
+func parseFileList(s string) []string {
+	return strings.Fields(strings.Trim(strings.TrimSpace(s), "[]"))
+}
+
+// logEntryField returns the rest of the first line in a log entry that
+// starts with prefix, or "" if there is none.
+func logEntryField(entry, prefix string) string {
+	for _, line := range splitLines(entry) {
+		if strings.HasPrefix(line, prefix) {
+			return line[len(prefix):]
+		}
+	}
+	return ""
+}
+
+// logValueFlags are the fool log flags that take a value.
+var logValueFlags = map[string]bool{
+	"n": true, "max-count": true, "grep": true, "author": true,
+	"format": true, "date": true, "abbrev": true,
+}
+
+// expandCountShorthand rewrites the "-<n>" shorthand (as in "fool log -5")
+// into "-n <n>" so the flag package can parse it. An argument that is the
+// value of a flag, as in "-n -1" or "--grep -1", is left alone.
+func expandCountShorthand(args []string) []string {
+	var out []string
+	for i, arg := range args {
+		if i > 0 && strings.HasPrefix(args[i-1], "-") && logValueFlags[strings.TrimLeft(args[i-1], "-")] {
+			out = append(out, arg)
+			continue
+		}
+		if len(arg) > 1 && arg[0] == '-' {
+			if n, err := strconv.Atoi(arg[1:]); err == nil {
+				out = append(out, "-n", strconv.Itoa(n))
+				continue
+			}
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// reformatLogDate rewrites the Date: line of a log entry using formatDate.
+func reformatLogDate(entry, format string) string {
+	if format == "" {
+		return entry
+	}
+	lines := splitLines(entry)
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "Date: ") {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, line[len("Date: "):]); err == nil {
+			lines[i] = "Date: " + formatDate(t, format)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func splitLogEntries(s string) []string {
+	var entries []string
+	start := 0
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] == '\n' && s[i+1] == '\n' {
+			entries = append(entries, s[start:i])
+			start = i + 2
+		}
+	}
+	if start < len(s) {
+		entries = append(entries, s[start:])
+	}
+	return entries
+}
+
+func cmdRm(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	cached := fs.Bool("cached", false, "only remove from tracking, keep the file on disk")
+	force := fs.Bool("f", false, "remove files even if they have uncommitted changes")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fmt.Println("Usage: fool rm [-f] [--cached] <file> [<file> ...]")
+		return
+	}
+	index := readIndex()
+	tracked, headID := getLastCommitFilesAndID()
+	failed := false
+	for _, file := range fs.Args() {
+		file = filepath.ToSlash(filepath.Clean(file))
+		wasStaged := containsString(index, file)
+		if !tracked[file] && !wasStaged {
+			fmt.Printf("File '%s' is not tracked.\n", file)
+			continue
+		}
+		// Deleting the working copy must not lose work that exists nowhere
+		// else.
+		if tracked[file] && !*cached && !*force {
+			data, err := os.ReadFile(file)
+			committed, _ := os.ReadFile(filepath.Join(".fool", "objects", headID, file))
+			if err == nil && !bytes.Equal(data, committed) {
+				fmt.Printf("Error: '%s' has uncommitted changes; use -f to remove it anyway or --cached to keep it.\n", file)
+				failed = true
+				continue
+			}
+		}
+		index = removeString(index, file)
+		if tracked[file] && !containsString(index, deleteMarker+file) {
+			index = append(index, deleteMarker+file)
+		}
+		// A file that was only staged is never committed anywhere, so it
+		// is unstaged but kept on disk.
+		if !*cached && tracked[file] {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				fmt.Printf("Error removing '%s': %v\n", file, err)
+				continue
+			}
+		}
+		if !tracked[file] {
+			fmt.Printf("Unstaged '%s'.\n", file)
+		} else if *cached {
+			fmt.Printf("Removed '%s' from tracking.\n", file)
+		} else {
+			fmt.Printf("Removed '%s'.\n", file)
+		}
+	}
+	if err := writeIndex(index); err != nil {
+		fmt.Println("Error updating index:", err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseRename splits a "rename:<src>:<dst>" index entry.
+func parseRename(line string) (src, dst string, ok bool) {
+	rest, found := strings.CutPrefix(line, renameMarker)
+	if !found {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
+
+func cmdMv(args []string) {
+	ensureRepo()
+	if len(args) != 2 {
+		fmt.Println("Usage: fool mv <src> <dst>")
+		return
+	}
+	src := filepath.ToSlash(filepath.Clean(args[0]))
+	dst := filepath.ToSlash(filepath.Clean(args[1]))
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		dst = filepath.ToSlash(filepath.Join(dst, filepath.Base(src)))
+	}
+	if strings.Contains(src, ":") || strings.Contains(dst, ":") {
+		fmt.Println("Error: fool mv does not support paths containing ':'.")
+		os.Exit(1)
+	}
+	index := readIndex()
+	tracked, _ := getLastCommitFilesAndID()
+	wasStaged := containsString(index, src)
+	if !tracked[src] && !wasStaged {
+		fmt.Printf("Error: '%s' is not tracked.\n", src)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(src); err != nil {
+		fmt.Printf("Error: '%s' does not exist.\n", src)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(dst); err == nil {
+		fmt.Printf("Error: destination '%s' already exists.\n", dst)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		fmt.Println("Error creating destination directory:", err)
+		os.Exit(1)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		fmt.Println("Error renaming file:", err)
+		os.Exit(1)
+	}
+	index = removeString(index, src)
+	if tracked[src] {
+		index = append(index, renameMarker+src+":"+dst)
+	} else {
+		// A file that was only staged has no history to rename, so the new
+		// path is simply staged instead.
+		index = append(index, dst)
+	}
+	if err := writeIndex(index); err != nil {
+		fmt.Println("Error updating index:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Renamed '%s' to '%s'\n", src, dst)
+}
+
+func cmdShow(args []string) {
+	ensureRepo()
+	if len(args) != 1 {
+		fmt.Println("Usage: fool show <commitID>[:<path>]")
+		return
+	}
+	if rev, path, ok := strings.Cut(args[0], ":"); ok {
+		showFile(rev, path)
+		return
+	}
+	commitID, err := resolveRef(args[0])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	c, err := loadCommit(commitID)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("commit %s\n", commitID)
+	if c.AuthorName != "" {
+		fmt.Printf("Author: %s <%s>\n", c.AuthorName, c.AuthorEmail)
+	}
+	fmt.Printf("Date: %s\n\n", c.Date.Format(time.RFC3339))
+	for _, line := range strings.Split(c.Message, "\n") {
+		fmt.Println(messageIndent + line)
+	}
+	fmt.Println()
+	fmt.Printf("Files: %v\n", c.Files)
+	changed := append(append([]string{}, c.Files...), c.Deleted...)
+	if len(c.Deleted) > 0 {
+		fmt.Printf("Deleted: %v\n", c.Deleted)
+	}
+	if len(c.Renamed) > 0 {
+		fmt.Printf("Renamed: %v\n", c.Renamed)
+		for _, r := range c.Renamed {
+			src, _, _ := strings.Cut(r, "->")
+			changed = append(changed, src)
+		}
+	}
+	parentID := c.Parent
+	for _, f := range changed {
+		f = filepath.ToSlash(filepath.Clean(f))
+		oldData, oldErr := os.ReadFile(filepath.Join(".fool", "objects", parentID, f))
+		newData, newErr := os.ReadFile(filepath.Join(".fool", "objects", commitID, f))
+		oldExists := parentID != "" && oldErr == nil
+		newExists := newErr == nil
+		fmt.Print(colorDiff(unifiedDiff(f, oldData, newData, oldExists, newExists)))
+	}
+}
+
+// showFile writes the contents path had in commit rev to stdout.
+func showFile(rev, path string) {
+	commitID, err := resolveRef(rev)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	clean := filepath.ToSlash(filepath.Clean(path))
+	if path == "" || clean == ".." || strings.HasPrefix(clean, "../") || filepath.IsAbs(path) {
+		fmt.Printf("Error: invalid path '%s'\n", path)
+		os.Exit(1)
+	}
+	full := filepath.Join(".fool", "objects", commitID, filepath.FromSlash(clean))
+	if info, err := os.Stat(full); err != nil || info.IsDir() || clean == "meta.txt" {
+		fmt.Printf("Error: path '%s' does not exist in commit %s\n", clean, abbrevID(commitID, defaultAbbrev))
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(full)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(data)
+}
+
+func cmdReset(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("reset", flag.ExitOnError)
+	soft := fs.Bool("soft", false, "undo the last commit but keep its changes staged")
+	fs.Parse(args)
+	rest := fs.Args()
+	if *soft {
+		if len(rest) > 1 || (len(rest) == 1 && rest[0] != "HEAD~1" && rest[0] != "HEAD~" && rest[0] != "HEAD^") {
+			fmt.Println("Usage: fool reset --soft [HEAD~1]")
+			return
+		}
+		resetSoft()
+		return
+	}
+	if len(rest) > 0 && rest[0] == "HEAD" {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		if err := writeIndex(nil); err != nil {
+			fmt.Println("Error clearing index:", err)
+			return
+		}
+		fmt.Println("Unstaged all changes.")
+		return
+	}
+	index := readIndex()
+	for _, file := range rest {
+		clean := filepath.ToSlash(filepath.Clean(file))
+		var renameEntry string
+		for _, line := range index {
+			if src, dst, ok := parseRename(line); ok && (src == clean || dst == clean) {
+				renameEntry = line
+			}
+		}
+		if !containsString(index, file) && !containsString(index, clean) && !containsString(index, deleteMarker+clean) && renameEntry == "" {
+			fmt.Printf("File '%s' is not staged.\n", file)
+			continue
+		}
+		index = removeString(removeString(removeString(removeString(index, file), clean), deleteMarker+clean), renameEntry)
+		fmt.Printf("Unstaged changes reset for '%s'\n", file)
+	}
+	if err := writeIndex(index); err != nil {
+		fmt.Println("Error updating index:", err)
+	}
+}
+
+// resetSoft drops the HEAD commit from the log, moves HEAD to the commit
+// before it and stages the dropped commit's files again, so committing
+// straight away recreates it. The working directory is left alone and the
+// commit's object directory is kept.
+func resetSoft() {
+	head := headCommitID()
+	last, err := loadCommit(head)
+	if head == "" || err != nil {
+		fmt.Println("Error: no commits to reset.")
+		os.Exit(1)
+	}
+	prev := last.Parent
+	index := readIndex()
+	renamedTo := map[string]bool{}
+	for _, r := range last.Renamed {
+		src, dst, _ := strings.Cut(r, "->")
+		renamedTo[dst] = true
+		if !containsString(index, renameMarker+src+":"+dst) {
+			index = append(index, renameMarker+src+":"+dst)
+		}
+	}
+	for _, f := range last.Files {
+		if !renamedTo[f] && !containsString(index, f) {
+			index = append(index, f)
+		}
+	}
+	for _, f := range last.Deleted {
+		if !containsString(index, deleteMarker+f) {
+			index = append(index, deleteMarker+f)
+		}
+	}
+	if err := replaceLogEntry(head, ""); err != nil {
+		fmt.Println("Error rewriting log:", err)
+		os.Exit(1)
+	}
+	if err := updateHEAD(prev); err != nil {
+		fmt.Println("Error updating HEAD:", err)
+		os.Exit(1)
+	}
+	appendReflog(head, prev, "reset", "moving to HEAD~1")
+	if err := writeIndex(index); err != nil {
+		fmt.Println("Error updating index:", err)
+		os.Exit(1)
+	}
+	if prev != "" {
+		fmt.Printf("HEAD is now at %s\n", prev)
+	} else {
+		fmt.Println("HEAD now has no commits.")
+	}
+}
+
+func cmdCheckout(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("checkout", flag.ExitOnError)
+	force := fs.Bool("force", false, "discard local modifications")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: fool checkout [--force] <branch|commitID>")
+		return
+	}
+	name := fs.Arg(0)
+	target, err := resolveRef(name)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	// A ref naming a missing commit must fail before any file is touched.
+	if _, err := loadCommit(target); err != nil {
+		fmt.Printf("Error: '%s' points to a commit that cannot be read: %v\n", name, err)
+		os.Exit(1)
+	}
+	_, isBranch := branchExists(name)
+	currentFiles, currentID := getLastCommitFilesAndID()
+	staged := readIndex()
+	changed := modifiedFiles(currentFiles, currentID)
+	for _, line := range staged {
+		if src, dst, ok := parseRename(line); ok {
+			changed = append(changed, src+" -> "+dst)
+		} else {
+			changed = append(changed, strings.TrimPrefix(line, deleteMarker))
+		}
+	}
+	if len(changed) > 0 && !*force {
+		fmt.Println("Error: your local changes would be overwritten by checkout:")
+		for _, f := range changed {
+			fmt.Println("  ", f)
+		}
+		fmt.Println("Commit your changes or use --force to discard them.")
+		os.Exit(1)
+	}
+	if clobbered := untrackedOverwrites(target); len(clobbered) > 0 && !*force {
+		fmt.Println("Error: the following untracked files would be overwritten by checkout:")
+		for _, f := range clobbered {
+			fmt.Println("  ", f)
+		}
+		fmt.Println("Move or remove them, or use --force to overwrite them.")
+		os.Exit(1)
+	}
+	// Pin the branch being left so it can be checked out again, even in a
+	// repository whose branch has never had a ref written.
+	if current := currentBranch(); current != "" && currentID != "" && readBranch(current) == "" {
+		if err := writeBranch(current, currentID); err != nil {
+			fmt.Println("Error updating branch:", err)
+			os.Exit(1)
+		}
+	}
+	restored, removed, err := restoreSnapshot(currentID, target)
+	for _, f := range restored {
+		fmt.Printf("Restored '%s'\n", f)
+	}
+	for _, f := range removed {
+		fmt.Printf("Removed '%s'\n", f)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if len(staged) > 0 {
+		// Only reached with --force: the staged changes are discarded.
+		if err := writeIndex(nil); err != nil {
+			fmt.Println("Error updating index:", err)
+			os.Exit(1)
+		}
+	}
+	from := currentBranch()
+	if from == "" {
+		from = abbrevID(currentID, defaultAbbrev)
+	}
+	appendReflog(currentID, target, "checkout", fmt.Sprintf("moving from %s to %s", from, name))
+	headPath := filepath.Join(".fool", "HEAD")
+	if isBranch {
+		if err := os.WriteFile(headPath, []byte("ref: refs/heads/"+name+"\n"), 0644); err != nil {
+			fmt.Println("Error updating HEAD:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Switched to branch '%s'\n", name)
+		return
+	}
+	if err := os.WriteFile(headPath, []byte(target+"\n"), 0644); err != nil {
+		fmt.Println("Error updating HEAD:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("HEAD is now detached at %s\n", target)
+}
+
+// untrackedOverwrites returns the untracked files in the working directory
+// that checking out target would replace with different contents.
+func untrackedOverwrites(target string) []string {
+	tracked := trackedPaths()
+	var clobbered []string
+	for _, f := range snapshotFiles(target) {
+		if tracked[f] {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		if committed, err := os.ReadFile(filepath.Join(".fool", "objects", target, f)); err != nil || !bytes.Equal(data, committed) {
+			clobbered = append(clobbered, f)
+		}
+	}
+	return clobbered
+}
+
+// restoreSnapshot replaces the files of commit currentID in the working
+// directory with those of commit target, returning what it wrote and what it
+// deleted up to the first error.
+func restoreSnapshot(currentID, target string) (restored, removed []string, err error) {
+	targetFiles := snapshotFiles(target)
+	for _, f := range targetFiles {
+		if err := copyFileToCommit(filepath.Join(".fool", "objects", target, f), f); err != nil {
+			return restored, removed, fmt.Errorf("restoring '%s': %v", f, err)
+		}
+		restored = append(restored, f)
+	}
+	for _, f := range snapshotFiles(currentID) {
+		if containsString(targetFiles, f) {
+			continue
+		}
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return restored, removed, fmt.Errorf("removing '%s': %v", f, err)
+		}
+		removed = append(removed, f)
+	}
+	return restored, removed, nil
+}
+
+func cmdStatus(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	var short, porcelain bool
+	fs.BoolVar(&short, "short", false, "print one '<XY> <file>' line per file")
+	fs.BoolVar(&porcelain, "porcelain", false, "same as --short, but never colored")
+	fs.Parse(args)
+
+	stagedSet := map[string]bool{}
+	var staged, deleted, renamed []string
+	for _, f := range readIndex() {
+		if strings.HasPrefix(f, deleteMarker) {
+			deleted = append(deleted, f[len(deleteMarker):])
+		} else if src, dst, ok := parseRename(f); ok {
+			renamed = append(renamed, src+" -> "+dst)
+		} else if !stagedSet[f] {
+			staged = append(staged, f)
+			stagedSet[f] = true
+		}
+	}
+	sort.Strings(staged)
+
+	lastCommitFiles, lastCommitID := getLastCommitFilesAndID()
+	untracked := untrackedFiles(trackedPaths(), parseIgnorePatterns(".foolignore"))
+
+	// Modified files are in the last commit, not staged, and differ on disk.
+	modified := []string{}
+	for _, f := range modifiedFiles(lastCommitFiles, lastCommitID) {
+		if stagedSet[f] || containsString(deleted, f) {
+			continue // staged files already shown
+		}
+		modified = append(modified, f)
+	}
+
+	if short || porcelain {
+		// Porcelain output is for scripts, so it is never colored.
+		code := func(color, c string) string {
+			if porcelain {
+				return c
+			}
+			return colorize(color, c)
+		}
+		for _, f := range staged {
+			fmt.Printf("%s  %s\n", code(colorGreen, "A"), f)
+		}
+		for _, f := range deleted {
+			fmt.Printf("%s  %s\n", code(colorGreen, "D"), f)
+		}
+		for _, r := range renamed {
+			fmt.Printf("%s  %s\n", code(colorGreen, "R"), r)
+		}
+		for _, f := range modified {
+			fmt.Printf("%s  %s\n", code(colorRed, "M"), f)
+		}
+		for _, f := range untracked {
+			fmt.Printf("%s  %s\n", code(colorYellow, "?"), f)
+		}
+		// A non-zero exit status lets scripts check for a dirty tree.
+		if len(staged)+len(deleted)+len(renamed)+len(modified) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if head := detachedHEAD(); head != "" {
+		fmt.Printf("HEAD detached at %s\n", head)
+	} else {
+		fmt.Printf("On branch %s\n", currentBranch())
+	}
+	printStatusSection("Staged files:", staged, colorGreen)
+	printStatusSection("Deleted files:", deleted, colorGreen)
+	printStatusSection("Renamed files:", renamed, colorGreen)
+	if len(staged) == 0 && len(deleted) == 0 && len(renamed) == 0 {
+		fmt.Println("No files staged for commit.")
+	}
+	printStatusSection("Untracked files:", untracked, colorYellow)
+	printStatusSection("Modified files:", modified, colorRed)
+}
+
+// trackedPaths returns the paths in the HEAD commit or staged in the index,
+// including the new side of staged renames.
+func trackedPaths() map[string]bool {
+	tracked, _ := getLastCommitFilesAndID()
+	for _, line := range readIndex() {
+		if _, dst, ok := parseRename(line); ok {
+			tracked[dst] = true
+		} else if !strings.HasPrefix(line, deleteMarker) {
+			tracked[filepath.ToSlash(filepath.Clean(line))] = true
+		}
+	}
+	return tracked
+}
+
+func printStatusSection(title string, files []string, color string) {
+	if len(files) == 0 {
+		return
+	}
+	fmt.Println(title)
+	for _, f := range files {
+		fmt.Println("  ", colorize(color, f))
+	}
+}
+
+// modifiedFiles returns, in sorted order, the files of a commit whose
+// working-directory contents differ from the committed version.
+func modifiedFiles(commitFiles map[string]bool, commitID string) []string {
+	var modified []string
+	for f := range commitFiles {
+		wdData, err1 := os.ReadFile(f)
+		commitData, err2 := os.ReadFile(filepath.Join(".fool", "objects", commitID, f))
+		if err1 == nil && err2 == nil && string(wdData) != string(commitData) {
+			modified = append(modified, f)
+		}
+	}
+	sort.Strings(modified)
+	return modified
+}
+
+func getLastCommitFilesAndID() (map[string]bool, string) {
+	commitID := headCommitID()
+	files := map[string]bool{}
+	for _, f := range snapshotFiles(commitID) {
+		files[f] = true
+	}
+	return files, commitID
+}
+
+// latestCommitID returns the ID of the most recent entry in .fool/log.
+func latestCommitID() string {
+	data, err := os.ReadFile(".fool/log")
+	if err != nil || len(data) == 0 {
+		return ""
+	}
+	entries := splitLogEntries(string(data))
+	if len(entries) == 0 {
+		return ""
+	}
+	var commitID string
+	for _, line := range splitLines(entries[len(entries)-1]) {
+		if len(line) > 7 && line[:7] == "commit " {
+			commitID = line[7:]
+		}
+	}
+	return commitID
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		return
+	}
+
+	// -C <dir> runs the command as if fool was started in <dir>, and
+	// -no-color turns off colored output, even with FOOL_COLOR=always.
+	argv := os.Args[1:]
+	noColor := false
+	for len(argv) > 0 {
+		if argv[0] == "-no-color" || argv[0] == "--no-color" {
+			noColor = true
+			argv = argv[1:]
+			continue
+		}
+		if len(argv) < 2 || argv[0] != "-C" {
+			break
+		}
+		if err := os.Chdir(argv[1]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		argv = argv[2:]
+	}
+	useColor = !noColor && os.Getenv("NO_COLOR") == "" && (os.Getenv("FOOL_COLOR") == "always" || stdoutIsTerminal())
+	if len(argv) == 0 {
+		printUsage()
+		return
+	}
+	cmd := argv[0]
+	args := argv[1:]
+
+	// Global help/version
+	if cmd == "--help" || cmd == "-h" {
+		printUsage()
+		return
+	}
+	if cmd == "version" {
+		cmdVersion()
+		return
+	}
+	if cmd == "help" {
+		cmdHelp(args)
+		return
+	}
+
+	switch cmd {
+	case "init":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("init")
+			return
+		}
+		cmdInit(args)
 	case "add":
 		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
 			printCommandHelp("add")
@@ -412,13 +1992,193 @@ func main() {
 			printCommandHelp("log")
 			return
 		}
-		cmdLog()
+		cmdLog(args)
 	case "status":
 		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
 			printCommandHelp("status")
 			return
 		}
-		cmdStatus()
+		cmdStatus(args)
+	case "rm":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("rm")
+			return
+		}
+		cmdRm(args)
+	case "branch":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("branch")
+			return
+		}
+		cmdBranch(args)
+	case "tag":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("tag")
+			return
+		}
+		cmdTag(args)
+	case "stash":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("stash")
+			return
+		}
+		cmdStash(args)
+	case "mv":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("mv")
+			return
+		}
+		cmdMv(args)
+	case "revert":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("revert")
+			return
+		}
+		cmdRevert(args)
+	case "cherry-pick":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("cherry-pick")
+			return
+		}
+		cmdCherryPick(args)
+	case "blame":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("blame")
+			return
+		}
+		cmdBlame(args)
+	case "grep":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("grep")
+			return
+		}
+		cmdGrep(args)
+	case "clean":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("clean")
+			return
+		}
+		cmdClean(args)
+	case "archive":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("archive")
+			return
+		}
+		cmdArchive(args)
+	case "gc":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("gc")
+			return
+		}
+		cmdGC(args)
+	case "config":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("config")
+			return
+		}
+		cmdConfig(args)
+	case "merge":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("merge")
+			return
+		}
+		cmdMerge(args)
+	case "ls-files":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("ls-files")
+			return
+		}
+		cmdLsFiles(args)
+	case "cat-file":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("cat-file")
+			return
+		}
+		cmdCatFile(args)
+	case "hash-object":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("hash-object")
+			return
+		}
+		cmdHashObject(args)
+	case "count-objects":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("count-objects")
+			return
+		}
+		cmdCountObjects(args)
+	case "reflog":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("reflog")
+			return
+		}
+		cmdReflog(args)
+	case "remote":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("remote")
+			return
+		}
+		cmdRemote(args)
+	case "push":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("push")
+			return
+		}
+		cmdPush(args)
+	case "serve":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("serve")
+			return
+		}
+		cmdServe(args)
+	case "clone":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("clone")
+			return
+		}
+		cmdClone(args)
+	case "fetch":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("fetch")
+			return
+		}
+		cmdFetch(args)
+	case "pull":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("pull")
+			return
+		}
+		cmdPull(args)
+	case "show":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("show")
+			return
+		}
+		cmdShow(args)
+	case "reset":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("reset")
+			return
+		}
+		cmdReset(args)
+	case "checkout":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("checkout")
+			return
+		}
+		cmdCheckout(args)
+	case "diff":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("diff")
+			return
+		}
+		cmdDiff(args)
+	case "interpret-trailers":
+		if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+			printCommandHelp("interpret-trailers")
+			return
+		}
+		cmdInterpretTrailers(args)
 	default:
 		fmt.Printf("Unknown command: %s\n", cmd)
 		printUsage()
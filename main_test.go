@@ -1,11 +1,21 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Helper to run fool CLI in a temp dir
@@ -39,6 +49,15 @@ func (env *FoolTestEnv) run(args ...string) (string, error) {
 	return string(out), err
 }
 
+// runEnv is run with extra environment variables, given as "KEY=value".
+func (env *FoolTestEnv) runEnv(vars []string, args ...string) (string, error) {
+	cmd := exec.Command(env.bin, args...)
+	cmd.Dir = env.tmpDir
+	cmd.Env = append(os.Environ(), vars...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
 func TestInit(t *testing.T) {
 	env := setupFoolTestEnv(t)
 	defer os.RemoveAll(env.tmpDir)
@@ -53,6 +72,17 @@ func TestInit(t *testing.T) {
 	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool")); err != nil {
 		t.Errorf(".fool directory not created")
 	}
+	for _, dir := range []string{"objects", "refs/heads", "refs/tags"} {
+		if info, err := os.Stat(filepath.Join(env.tmpDir, ".fool", dir)); err != nil || !info.IsDir() {
+			t.Errorf(".fool/%s directory not created", dir)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "HEAD")); string(data) != "ref: refs/heads/main\n" {
+		t.Errorf("unexpected .fool/HEAD: %q", data)
+	}
+	if out, _ := env.run("config", "core.repositoryformatversion"); out != "0\n" {
+		t.Errorf("unexpected core.repositoryformatversion: %q", out)
+	}
 }
 
 func TestAdd(t *testing.T) {
@@ -209,6 +239,14 @@ func TestStatus(t *testing.T) {
 	if !strings.Contains(out, "b.txt") {
 		t.Errorf("untracked file not shown in status: %s", out)
 	}
+	if !strings.HasPrefix(out, "On branch main\n") {
+		t.Errorf("status should start with the branch name: %s", out)
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, ".fool", "HEAD"), []byte("ref: refs/heads/feature\n"), 0644)
+	out, _ = env.run("status")
+	if !strings.HasPrefix(out, "On branch feature\n") {
+		t.Errorf("status should show the branch from HEAD: %s", out)
+	}
 }
 
 func TestVersionAndHelp(t *testing.T) {
@@ -229,3 +267,2891 @@ func TestVersionAndHelp(t *testing.T) {
 		t.Errorf("help output unexpected: %s", out)
 	}
 }
+
+func TestCommitReuseMessage(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, err := env.run("commit", "-m", "original message")
+	if err != nil {
+		t.Fatalf("commit failed: %v, output: %s", err, out)
+	}
+	commitID := strings.TrimSpace(out[strings.LastIndex(out, " ")+1:])
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	env.run("add", "b.txt")
+	out, err = env.run("commit", "-C", commitID)
+	if err != nil {
+		t.Fatalf("commit -C failed: %v, output: %s", err, out)
+	}
+	if !strings.Contains(out, "Committed 1 file(s)") {
+		t.Errorf("unexpected commit output: %s", out)
+	}
+	logData, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "log"))
+	if strings.Count(string(logData), "Message: original message") != 2 {
+		t.Errorf("message was not reused:\n%s", logData)
+	}
+	out, _ = env.run("commit", "-C", "deadbeef")
+	if !strings.Contains(out, "unknown commit") {
+		t.Errorf("expected unknown commit error: %s", out)
+	}
+}
+
+func TestInterpretTrailersParse(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	msg := "Fix the frobnicator\n\nIt was broken.\n\nFixes: #12\nReviewed-by: Alice\n  <alice@example.com>\nCloses:\n"
+	os.WriteFile(filepath.Join(env.tmpDir, "msg.txt"), []byte(msg), 0644)
+	out, err := env.run("interpret-trailers", "--parse", "--trim-empty", "--file", "msg.txt")
+	if err != nil {
+		t.Fatalf("interpret-trailers failed: %v, output: %s", err, out)
+	}
+	want := "Fixes: #12\nReviewed-by: Alice <alice@example.com>\n"
+	if out != want {
+		t.Errorf("unexpected trailers:\n%s\nwant:\n%s", out, want)
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "plain.txt"), []byte("Subject only\n\nNo trailers here.\n"), 0644)
+	out, _ = env.run("interpret-trailers", "--parse", "--file", "plain.txt")
+	if out != "" {
+		t.Errorf("expected no trailers, got: %s", out)
+	}
+}
+
+func TestCommitOnlyAndExclude(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		os.WriteFile(filepath.Join(env.tmpDir, name), []byte(name), 0644)
+	}
+	env.run("add", "a.txt", "b.txt")
+	out, err := env.run("commit", "-m", "only a and c", "--only", "a.txt", "c.txt")
+	if err != nil {
+		t.Fatalf("commit --only failed: %v, output: %s", err, out)
+	}
+	if !strings.Contains(out, "'c.txt' was not staged") || !strings.Contains(out, "Committed 2 file(s)") {
+		t.Errorf("unexpected commit output: %s", out)
+	}
+	indexData, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if strings.TrimSpace(string(indexData)) != "b.txt" {
+		t.Errorf("expected only b.txt to remain staged, got: %q", indexData)
+	}
+	env.run("add", "a.txt")
+	out, err = env.run("commit", "-m", "all but a", "--exclude", "a.txt")
+	if err != nil {
+		t.Fatalf("commit --exclude failed: %v, output: %s", err, out)
+	}
+	if !strings.Contains(out, "Committed 1 file(s)") {
+		t.Errorf("unexpected commit output: %s", out)
+	}
+	indexData, _ = os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if strings.TrimSpace(string(indexData)) != "a.txt" {
+		t.Errorf("expected only a.txt to remain staged, got: %q", indexData)
+	}
+}
+
+func TestLogDateFormat(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "dated")
+	out, err := env.run("log", "--date=format:%Y/%m/%d %%")
+	if err != nil {
+		t.Fatalf("log failed: %v, output: %s", err, out)
+	}
+	want := "Date: " + time.Now().UTC().Format("2006/01/02") + " %"
+	if !strings.Contains(out, want) {
+		t.Errorf("expected %q in log output: %s", want, out)
+	}
+	out, _ = env.run("log", "--date=relative")
+	if !strings.Contains(out, " ago") {
+		t.Errorf("expected relative date in log output: %s", out)
+	}
+	out, err = env.run("log", "--date=bogus")
+	if err == nil || !strings.Contains(out, "unknown date format") {
+		t.Errorf("expected unknown date format error: %s", out)
+	}
+}
+
+func TestAddVerbose(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	file := filepath.Join(env.tmpDir, "a.txt")
+	os.WriteFile(file, []byte("one\ntwo\nthree\n"), 0644)
+	out, err := env.run("add", "-v", "a.txt")
+	if err != nil {
+		t.Fatalf("add -v failed: %v, output: %s", err, out)
+	}
+	if !strings.Contains(out, "new file: a.txt (3 lines)") {
+		t.Errorf("unexpected add -v output: %s", out)
+	}
+	env.run("commit", "-m", "first")
+	os.WriteFile(file, []byte("one\n2\nthree\nfour\n"), 0644)
+	out, _ = env.run("add", "--verbose", "a.txt")
+	if !strings.Contains(out, "modified: a.txt (+2, -1 lines)") {
+		t.Errorf("unexpected add --verbose output: %s", out)
+	}
+}
+
+func TestCommitSignoff(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	config := "[user]\n\tname = Alice\n\temail = alice@example.com\n"
+	os.WriteFile(filepath.Join(env.tmpDir, ".fool", "config"), []byte(config), 0644)
+	out, err := env.run("commit", "-s", "-m", "signed")
+	if err != nil {
+		t.Fatalf("commit -s failed: %v, output: %s", err, out)
+	}
+	logData, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "log"))
+	if !strings.Contains(string(logData), "Message: signed\n    \n    Signed-off-by: Alice <alice@example.com>\n") {
+		t.Errorf("sign-off missing from log:\n%s", logData)
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	env.run("add", "b.txt")
+	env.run("commit", "--signoff", "-m", "again\n\nSigned-off-by: Alice <alice@example.com>")
+	out, _ = env.run("log")
+	if strings.Count(out, "Signed-off-by") != 2 {
+		t.Errorf("expected one sign-off per commit:\n%s", out)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("one\ntwo\nthree\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "bin.dat"), []byte("a\x00b"), 0644)
+	env.run("add", "a.txt", "bin.dat")
+	env.run("commit", "-m", "first")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("one\n2\nthree\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "bin.dat"), []byte("a\x00c"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "new.txt"), []byte("new\n"), 0644)
+	env.run("add", "new.txt")
+	out, err := env.run("diff")
+	if err != nil {
+		t.Fatalf("diff failed: %v, output: %s", err, out)
+	}
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("unexpected diff output:\n%s", out)
+	}
+	if !strings.Contains(out, "Binary files differ") {
+		t.Errorf("binary file not reported: %s", out)
+	}
+	if strings.Contains(out, "new.txt") {
+		t.Errorf("uncommitted file shown without --cached: %s", out)
+	}
+	out, _ = env.run("diff", "--cached", "new.txt")
+	if !strings.Contains(out, "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,1 @@\n+new\n") {
+		t.Errorf("unexpected diff --cached output:\n%s", out)
+	}
+}
+
+func TestDiffCached(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		os.WriteFile(filepath.Join(env.tmpDir, name), []byte(name+"\n"), 0644)
+	}
+	env.run("add", "a.txt", "b.txt", "c.txt")
+	env.run("commit", "-m", "first")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("changed\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "c.txt"), []byte("unstaged\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "new.txt"), []byte("new\n"), 0644)
+	env.run("add", "a.txt", "new.txt")
+	env.run("rm", "b.txt")
+
+	out, err := env.run("diff", "--cached")
+	if err != nil {
+		t.Fatalf("diff --cached failed: %v\n%s", err, out)
+	}
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -1,1 +1,1 @@\n-a.txt\n+changed\n" +
+		"--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,1 @@\n+new\n" +
+		"--- a/b.txt\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-b.txt\n"
+	if out != want {
+		t.Errorf("unexpected diff --cached output:\n%s", out)
+	}
+	env.run("reset", "HEAD")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a.txt\n"), 0644)
+	env.run("add", "a.txt")
+	if out, _ := env.run("diff", "--cached"); out != "" {
+		t.Errorf("an unmodified staged file should produce no output:\n%s", out)
+	}
+}
+
+// commitIDFromOutput extracts the ID from commit's "Committed ... with id X" line.
+func commitIDFromOutput(t *testing.T, out string) string {
+	t.Helper()
+	i := strings.LastIndex(out, "with id ")
+	if i < 0 {
+		t.Fatalf("no commit id in output: %s", out)
+	}
+	return strings.TrimSpace(out[i+len("with id "):])
+}
+
+func TestCheckoutCommit(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	file := filepath.Join(env.tmpDir, "a.txt")
+	os.WriteFile(file, []byte("v1"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "v1")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(file, []byte("v2"), 0644)
+	env.run("add", "a.txt")
+	out, _ = env.run("commit", "-m", "v2")
+	second := commitIDFromOutput(t, out)
+
+	out, err := env.run("checkout", first)
+	if err != nil {
+		t.Fatalf("checkout failed: %v, output: %s", err, out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "v1" {
+		t.Errorf("file not restored, got %q", data)
+	}
+	out, _ = env.run("status")
+	if !strings.Contains(out, "HEAD detached at "+first) {
+		t.Errorf("status does not show detached HEAD: %s", out)
+	}
+
+	os.WriteFile(file, []byte("local edit"), 0644)
+	out, err = env.run("checkout", second)
+	if err == nil || !strings.Contains(out, "would be overwritten") {
+		t.Errorf("checkout should refuse with local changes: %s", out)
+	}
+	if _, err := env.run("checkout", "--force", "main"); err != nil {
+		t.Fatalf("checkout --force failed")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "v2" {
+		t.Errorf("file not restored, got %q", data)
+	}
+	if head, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "HEAD")); string(head) != "ref: refs/heads/main\n" {
+		t.Errorf("HEAD should be reattached to main, got %q", head)
+	}
+}
+
+func TestRm(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		os.WriteFile(filepath.Join(env.tmpDir, name), []byte(name), 0644)
+	}
+	env.run("add", "a.txt", "b.txt", "c.txt")
+	env.run("commit", "-m", "three files")
+	out, err := env.run("rm", "a.txt")
+	if err != nil {
+		t.Fatalf("rm failed: %v, output: %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("rm did not delete the file")
+	}
+	env.run("rm", "--cached", "b.txt")
+	if _, err := os.Stat(filepath.Join(env.tmpDir, "b.txt")); err != nil {
+		t.Errorf("rm --cached deleted the file")
+	}
+	out, _ = env.run("status")
+	if !strings.Contains(out, "Deleted files:") {
+		t.Errorf("status does not show deletions: %s", out)
+	}
+	out, err = env.run("commit", "-m", "remove two")
+	if err != nil || !strings.Contains(out, "2 deletion(s)") {
+		t.Fatalf("commit failed: %v, output: %s", err, out)
+	}
+	id := commitIDFromOutput(t, out)
+	meta, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", id, "meta.txt"))
+	if !strings.Contains(string(meta), "deleted: [a.txt b.txt]") {
+		t.Errorf("meta.txt does not list deletions:\n%s", meta)
+	}
+	for name, want := range map[string]bool{"a.txt": false, "b.txt": false, "c.txt": true} {
+		_, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", id, name))
+		if (err == nil) != want {
+			t.Errorf("%s in snapshot = %v, want %v", name, err == nil, want)
+		}
+	}
+}
+
+func TestRmKeepsUncommittedWork(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	aPath := filepath.Join(env.tmpDir, "a.txt")
+	os.WriteFile(aPath, []byte("a\n"), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "base")
+
+	// A file that was only staged is unstaged but stays on disk.
+	nPath := filepath.Join(env.tmpDir, "n.txt")
+	os.WriteFile(nPath, []byte("new\n"), 0644)
+	env.run("add", "n.txt")
+	out, err := env.run("rm", "n.txt")
+	if err != nil || !strings.Contains(out, "Unstaged 'n.txt'.") {
+		t.Errorf("rm of a staged file failed: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(nPath); string(data) != "new\n" {
+		t.Errorf("rm deleted the only copy of n.txt: %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index")); len(data) != 0 {
+		t.Errorf("n.txt should be unstaged: %q", data)
+	}
+
+	// A tracked file with uncommitted edits needs -f.
+	os.WriteFile(aPath, []byte("a\nedited\n"), 0644)
+	out, err = env.run("rm", "a.txt")
+	if err == nil || !strings.Contains(out, "uncommitted changes") {
+		t.Errorf("rm of a modified file should fail: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(aPath); string(data) != "a\nedited\n" {
+		t.Errorf("rm without -f changed a.txt: %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index")); len(data) != 0 {
+		t.Errorf("a refused rm must not stage the deletion: %q", data)
+	}
+	if out, err := env.run("rm", "-f", "a.txt"); err != nil || !strings.Contains(out, "Removed 'a.txt'.") {
+		t.Errorf("rm -f failed: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(aPath); !os.IsNotExist(err) {
+		t.Errorf("rm -f should delete a.txt")
+	}
+}
+
+func TestAddDuplicateArgs(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	out, err := env.run("add", "a.txt", "missing.txt", "a.txt", "b.txt")
+	if err != nil {
+		t.Fatalf("add failed: %v, output: %s", err, out)
+	}
+	if strings.Count(out, "Added 'a.txt'") != 1 || !strings.Contains(out, "Added 'b.txt'") {
+		t.Errorf("each file should be added once: %s", out)
+	}
+	if !strings.Contains(out, "'a.txt' is already staged") || !strings.Contains(out, "'missing.txt' does not exist") {
+		t.Errorf("unexpected add output: %s", out)
+	}
+	indexData, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if string(indexData) != "a.txt\nb.txt\n" {
+		t.Errorf("unexpected index contents: %q", indexData)
+	}
+}
+
+func TestAddAll(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.MkdirAll(filepath.Join(env.tmpDir, "src", "pkg"), 0755)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "pkg", "b.go"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "c.o"), []byte("c"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, ".foolignore"), []byte("*.o\nfool\n"), 0644)
+	out, err := env.run("add", ".")
+	if err != nil {
+		t.Fatalf("add . failed: %v, output: %s", err, out)
+	}
+	if !strings.Contains(out, "Staged 3 file(s).") {
+		t.Errorf("unexpected add . output: %s", out)
+	}
+	indexData, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	for _, want := range []string{".foolignore", "a.txt", "src/pkg/b.go"} {
+		if !strings.Contains(string(indexData), want+"\n") {
+			t.Errorf("index missing %s: %q", want, indexData)
+		}
+	}
+	if strings.Contains(string(indexData), "c.o") || strings.Contains(string(indexData), ".fool/") {
+		t.Errorf("index contains ignored or metadata files: %q", indexData)
+	}
+	out, _ = env.run("commit", "-m", "everything")
+	id := commitIDFromOutput(t, out)
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", id, "src", "pkg", "b.go")); err != nil {
+		t.Errorf("nested file not committed: %v", err)
+	}
+}
+
+func TestAddDirectory(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.MkdirAll(filepath.Join(env.tmpDir, "src", "pkg"), 0755)
+	os.MkdirAll(filepath.Join(env.tmpDir, "src", "build"), 0755)
+	os.WriteFile(filepath.Join(env.tmpDir, "top.txt"), []byte("t"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "a.go"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "a.o"), []byte("o"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "pkg", "b.go"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "build", "out.go"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, ".foolignore"), []byte("*.o\nbuild/\nfool\n"), 0644)
+	out, err := env.run("add", "src/")
+	if err != nil {
+		t.Fatalf("add src/ failed: %v, output: %s", err, out)
+	}
+	data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if string(data) != "src/a.go\nsrc/pkg/b.go\n" {
+		t.Errorf("unexpected index after add src/: %q", data)
+	}
+	out, _ = env.run("commit", "-m", "src")
+	id := commitIDFromOutput(t, out)
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", id, "src", "pkg", "b.go")); err != nil {
+		t.Errorf("nested file not committed: %v", err)
+	}
+}
+
+func TestAddForce(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.MkdirAll(filepath.Join(env.tmpDir, "dist"), 0755)
+	os.WriteFile(filepath.Join(env.tmpDir, "dist", "myapp"), []byte("bin"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, ".foolignore"), []byte("dist/\nfool\n"), 0644)
+	out, err := env.run("add", "a.txt", "dist/myapp")
+	if err == nil || !strings.Contains(out, "The following paths are ignored by .foolignore: dist/myapp. Use --force if you really want to add them.") {
+		t.Errorf("expected a failure naming the ignored path, got %v:\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index")); string(data) != "a.txt\n" {
+		t.Errorf("only a.txt should be staged: %q", data)
+	}
+	out, err = env.run("add", "--force", "dist/myapp")
+	if err != nil || !strings.Contains(out, "Added 'dist/myapp' to staging area.") {
+		t.Errorf("add --force failed: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index")); string(data) != "a.txt\ndist/myapp\n" {
+		t.Errorf("unexpected index after add --force: %q", data)
+	}
+}
+
+func TestAddDryRun(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.go"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "b.go"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "c.o"), []byte("c"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, ".foolignore"), []byte("*.o\nfool\n"), 0644)
+	out, err := env.run("add", "--dry-run", ".")
+	if err != nil {
+		t.Fatalf("add --dry-run . failed: %v, output: %s", err, out)
+	}
+	for _, want := range []string{"would add: a.go", "would add: b.go", "would add: .foolignore"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry run output missing %q: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "c.o") {
+		t.Errorf("dry run listed an ignored file: %s", out)
+	}
+	// The glob is quoted so fool, not the shell, expands it.
+	out, _ = env.run("add", "-n", "*.go")
+	if !strings.Contains(out, "would add: a.go") || !strings.Contains(out, "would add: b.go") {
+		t.Errorf("unexpected glob dry run output: %s", out)
+	}
+	out, _ = env.run("add", "--dry-run", "a.go")
+	if strings.TrimSpace(out) != "would add: a.go" {
+		t.Errorf("unexpected dry run output: %s", out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index")); len(data) != 0 {
+		t.Errorf("dry run changed the index: %q", data)
+	}
+	env.run("add", "a.go")
+	out, _ = env.run("add", "--dry-run", "a.go")
+	if !strings.Contains(out, "No new files would be added") {
+		t.Errorf("expected nothing to add, got: %s", out)
+	}
+}
+
+func TestAddUpdate(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	for _, f := range []string{"keep.txt", "edit.txt", "gone.txt"} {
+		os.WriteFile(filepath.Join(env.tmpDir, f), []byte(f+"\n"), 0644)
+		env.run("add", f)
+	}
+	env.run("commit", "-m", "base")
+	os.WriteFile(filepath.Join(env.tmpDir, "edit.txt"), []byte("changed\n"), 0644)
+	os.Remove(filepath.Join(env.tmpDir, "gone.txt"))
+	os.WriteFile(filepath.Join(env.tmpDir, "new.txt"), []byte("new\n"), 0644)
+
+	out, _ := env.run("add", "-u", "--dry-run")
+	if !strings.Contains(out, "would add: edit.txt") || !strings.Contains(out, "would remove: gone.txt") {
+		t.Errorf("unexpected dry run output: %s", out)
+	}
+	out, err := env.run("add", "-u")
+	if err != nil {
+		t.Fatalf("add -u failed: %v, output: %s", err, out)
+	}
+	if !strings.Contains(out, "Staged 2 file(s).") {
+		t.Errorf("unexpected add -u output: %s", out)
+	}
+	data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if string(data) != "delete:gone.txt\nedit.txt\n" {
+		t.Errorf("unexpected index after add -u: %q", data)
+	}
+	out, _ = env.run("commit", "-m", "update")
+	id := commitIDFromOutput(t, out)
+	objects := filepath.Join(env.tmpDir, ".fool", "objects", id)
+	if got, _ := os.ReadFile(filepath.Join(objects, "edit.txt")); string(got) != "changed\n" {
+		t.Errorf("edit.txt not committed: %q", got)
+	}
+	for _, f := range []string{"gone.txt", "new.txt"} {
+		if _, err := os.Stat(filepath.Join(objects, f)); err == nil {
+			t.Errorf("%s should not be in the commit", f)
+		}
+	}
+	out, _ = env.run("add", "-u")
+	if !strings.Contains(out, "No new files were added") {
+		t.Errorf("expected nothing to stage, got: %s", out)
+	}
+}
+
+func TestFoolignore(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.MkdirAll(filepath.Join(env.tmpDir, "build"), 0755)
+	os.MkdirAll(filepath.Join(env.tmpDir, "src"), 0755)
+	os.WriteFile(filepath.Join(env.tmpDir, ".foolignore"), []byte("# build output\n*.o\nbuild/\nfool\nnotes.txt\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "main.c"), []byte("c"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "main.o"), []byte("o"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "notes.txt"), []byte("n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "build", "app"), []byte("app"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "util.o"), []byte("o"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "build"), []byte("not a dir"), 0644)
+	out, err := env.run("status")
+	if err != nil {
+		t.Fatalf("status failed: %v, output: %s", err, out)
+	}
+	if !strings.Contains(out, "main.c") {
+		t.Errorf("untracked file missing from status: %s", out)
+	}
+	for _, ignored := range []string{"main.o", "notes.txt", "   fool"} {
+		if strings.Contains(out, ignored) {
+			t.Errorf("ignored file %q shown in status: %s", ignored, out)
+		}
+	}
+	env.run("add", ".")
+	indexData, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if string(indexData) != ".foolignore\nmain.c\nsrc/build\n" {
+		t.Errorf("unexpected index contents: %q", indexData)
+	}
+}
+
+func TestCommitAuthor(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, ".fool", "config"), []byte("[user]\nname = Alice\nemail = alice@example.com\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "from config")
+	id := commitIDFromOutput(t, out)
+	meta, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", id, "meta.txt"))
+	if !strings.Contains(string(meta), "author.name: Alice\nauthor.email: alice@example.com\n") {
+		t.Errorf("meta.txt missing author:\n%s", meta)
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	env.run("add", "b.txt")
+	out, err := env.run("commit", "-m", "overridden", "--author", "Bob <bob@example.com>")
+	if err != nil {
+		t.Fatalf("commit --author failed: %v, output: %s", err, out)
+	}
+	out, _ = env.run("log")
+	if !strings.Contains(out, "Author: Bob <bob@example.com>\nDate: ") || !strings.Contains(out, "Author: Alice <alice@example.com>\nDate: ") {
+		t.Errorf("log does not show authors:\n%s", out)
+	}
+	out, _ = env.run("commit", "-m", "bad", "--author", "nobody")
+	if !strings.Contains(out, "--author must look like") {
+		t.Errorf("expected invalid author error: %s", out)
+	}
+}
+
+func TestLogMaxCount(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	for _, name := range []string{"one", "two", "three"} {
+		os.WriteFile(filepath.Join(env.tmpDir, name), []byte(name), 0644)
+		env.run("add", name)
+		env.run("commit", "-m", "commit "+name)
+	}
+	for _, args := range [][]string{{"log", "-n", "2"}, {"log", "--max-count=2"}, {"log", "-2"}} {
+		out, err := env.run(args...)
+		if err != nil {
+			t.Fatalf("%v failed: %v, output: %s", args, err, out)
+		}
+		if strings.Count(out, "Message: ") != 2 || !strings.Contains(out, "commit three") || strings.Contains(out, "commit one") {
+			t.Errorf("%v: expected the two newest commits:\n%s", args, out)
+		}
+	}
+	out, _ := env.run("log", "-n", "0")
+	if strings.Count(out, "Message: ") != 3 {
+		t.Errorf("-n 0 should show all commits:\n%s", out)
+	}
+	for _, args := range [][]string{{"log", "-n", "-1"}, {"log", "--max-count", "-1"}} {
+		out, err := env.run(args...)
+		if err != nil || strings.Count(out, "Message: ") != 3 {
+			t.Errorf("%v: a negative count should show all commits: %v\n%s", args, err, out)
+		}
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "one"), []byte("1"), 0644)
+	env.run("commit", "-a", "-m", "fix off-by -1")
+	for _, args := range [][]string{{"log", "--grep", "-1"}, {"log", "-grep", "-1", "--oneline"}} {
+		out, err := env.run(args...)
+		if err != nil || !strings.Contains(out, "fix off-by -1") || strings.Contains(out, "commit three") {
+			t.Errorf("%v: -1 should be the --grep pattern: %v\n%s", args, err, out)
+		}
+	}
+}
+
+func TestLogOneline(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "initial import\n\nWith a body.")
+	id := commitIDFromOutput(t, out)
+	out, err := env.run("log", "--oneline")
+	if err != nil {
+		t.Fatalf("log --oneline failed: %v, output: %s", err, out)
+	}
+	if out != id[:8]+" initial import\n" {
+		t.Errorf("unexpected oneline output: %q", out)
+	}
+	cmd := exec.Command(env.bin, "log")
+	cmd.Dir = env.tmpDir
+	cmd.Env = append(os.Environ(), "FOOL_LOG_FORMAT=oneline")
+	envOut, _ := cmd.CombinedOutput()
+	if string(envOut) != out {
+		t.Errorf("FOOL_LOG_FORMAT=oneline output differs: %q", envOut)
+	}
+}
+
+func TestCommitsForFile(t *testing.T) {
+	commits := []*CommitMeta{
+		{ID: "cccc", Deleted: []string{"a.txt"}},
+		{ID: "bbbb", Files: []string{"b.txt"}},
+		{ID: "aaaa", Files: []string{"a.txt", "b.txt"}},
+	}
+	got := commitsForFile(commits, "a.txt")
+	if len(got) != 2 || got[0].ID != "cccc" || got[1].ID != "aaaa" {
+		t.Errorf("unexpected commits for a.txt: %v", got)
+	}
+	if got := commitsForFile(commits, "missing.txt"); len(got) != 0 {
+		t.Errorf("expected no commits for missing.txt, got %v", got)
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "add a")
+	env.run("add", "b.txt")
+	env.run("commit", "-m", "add b")
+	out, err := env.run("log", "--oneline", "a.txt")
+	if err != nil {
+		t.Fatalf("log a.txt failed: %v, output: %s", err, out)
+	}
+	if !strings.Contains(out, "add a") || strings.Contains(out, "add b") {
+		t.Errorf("unexpected history for a.txt:\n%s", out)
+	}
+	out, _ = env.run("log", "nope.txt")
+	if !strings.Contains(out, "No commits found for 'nope.txt'") {
+		t.Errorf("unexpected output for unknown file: %s", out)
+	}
+}
+
+func TestCommitManyFiles(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	dir := filepath.Join(env.tmpDir, "many")
+	os.Mkdir(dir, 0755)
+	for i := 0; i < 1100; i++ {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%04d.txt", i)), []byte(fmt.Sprint(i)), 0644)
+	}
+	if out, err := env.run("add", "."); err != nil {
+		t.Fatalf("add failed: %v, output: %s", err, out)
+	}
+	out, err := env.run("commit", "-m", "many files")
+	if err != nil {
+		t.Fatalf("commit failed: %v, output: %s", err, out)
+	}
+	if strings.Contains(out, "Warning") || !strings.Contains(out, "Committed 1101 file(s)") {
+		t.Errorf("unexpected commit output: %s", out)
+	}
+}
+
+func TestReset(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	env.run("add", "a.txt", "b.txt")
+	out, err := env.run("reset", "HEAD", "a.txt")
+	if err != nil || !strings.Contains(out, "Unstaged changes reset for 'a.txt'") {
+		t.Fatalf("reset HEAD a.txt failed: %v, output: %s", err, out)
+	}
+	indexData, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if string(indexData) != "b.txt\n" {
+		t.Errorf("unexpected index after reset: %q", indexData)
+	}
+	env.run("reset", "HEAD")
+	indexData, _ = os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if len(indexData) != 0 {
+		t.Errorf("index not cleared: %q", indexData)
+	}
+
+	env.run("add", "a.txt")
+	out, _ = env.run("commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	env.run("add", "b.txt")
+	env.run("commit", "-m", "second")
+	out, err = env.run("reset", "--soft")
+	if err != nil || !strings.Contains(out, "HEAD is now at "+first) {
+		t.Fatalf("reset --soft failed: %v, output: %s", err, out)
+	}
+	indexData, _ = os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if string(indexData) != "b.txt\n" {
+		t.Errorf("undone commit's files not staged: %q", indexData)
+	}
+	out, _ = env.run("log", "--oneline")
+	if strings.Contains(out, "second") || !strings.Contains(out, "first") {
+		t.Errorf("unexpected log after reset --soft: %s", out)
+	}
+}
+
+func TestShow(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	file := filepath.Join(env.tmpDir, "a.txt")
+	os.WriteFile(file, []byte("one\ntwo\n"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(file, []byte("one\n2\n"), 0644)
+	env.run("add", "a.txt")
+	out, _ = env.run("commit", "-m", "second")
+	second := commitIDFromOutput(t, out)
+
+	out, err := env.run("show", second[:4])
+	if err != nil {
+		t.Fatalf("show failed: %v, output: %s", err, out)
+	}
+	for _, want := range []string{"commit " + second, "    second", "Files: [a.txt]", "-two\n+2\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("show output missing %q:\n%s", want, out)
+		}
+	}
+	out, _ = env.run("show", first)
+	if !strings.Contains(out, "--- /dev/null\n+++ b/a.txt\n") {
+		t.Errorf("first commit should diff against /dev/null:\n%s", out)
+	}
+	out, err = env.run("show", "zzzzzzzz")
+	if err == nil || !strings.Contains(out, "unknown commit") {
+		t.Errorf("expected unknown commit error: %s", out)
+	}
+}
+
+func TestCommitAmend(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "tpyo")
+	old := commitIDFromOutput(t, out)
+	env.run("add", "b.txt")
+	out, err := env.run("commit", "--amend", "-m", "typo fixed")
+	if err != nil || !strings.Contains(out, "Amended commit "+old) {
+		t.Fatalf("commit --amend failed: %v, output: %s", err, out)
+	}
+	id := commitIDFromOutput(t, out)
+	// The replaced commit stays recoverable through the reflog.
+	if out, _ := env.run("reflog"); !strings.Contains(out, old[:8]+" HEAD@{1}: commit (initial)") {
+		t.Errorf("amended commit missing from the reflog:\n%s", out)
+	}
+	if out, err := env.run("show", old); err != nil || !strings.Contains(out, "tpyo") {
+		t.Errorf("amended commit should still be readable: %v\n%s", err, out)
+	}
+	for _, f := range []string{"a.txt", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", id, f)); err != nil {
+			t.Errorf("%s missing from amended commit", f)
+		}
+	}
+	out, _ = env.run("log")
+	if strings.Count(out, "Message: ") != 1 || !strings.Contains(out, "Message: typo fixed") || !strings.Contains(out, "Files: [a.txt b.txt]") {
+		t.Errorf("log entry not replaced:\n%s", out)
+	}
+	out, _ = env.run("commit", "--amend", "-m", "message only")
+	if !strings.Contains(out, "committed 2 file(s)") {
+		t.Errorf("unexpected output amending only the message: %s", out)
+	}
+	out, _ = env.run("log", "--oneline")
+	if strings.Count(out, "\n") != 1 || !strings.Contains(out, "message only") {
+		t.Errorf("unexpected log after message-only amend:\n%s", out)
+	}
+}
+
+func TestBranch(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	if out, err := env.run("branch", "feature"); err == nil {
+		t.Errorf("branch before the first commit should fail, output: %s", out)
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "first")
+	id := commitIDFromOutput(t, out)
+	out, err := env.run("branch", "feature")
+	if err != nil || !strings.Contains(out, "Created branch feature at "+id) {
+		t.Fatalf("branch failed: %v, output: %s", err, out)
+	}
+	out, _ = env.run("branch")
+	if out != "  feature\n* main\n" {
+		t.Errorf("unexpected branch listing:\n%s", out)
+	}
+	if out, err := env.run("branch", "feature"); err == nil || !strings.Contains(out, "already exists") {
+		t.Errorf("creating a duplicate branch should fail, output: %s", out)
+	}
+	for _, name := range []string{"-x", "a..b", "bad name", "x:y", "trailing/", "x.lock", "feature/sub"} {
+		if out, err := env.run("branch", "--", name); err == nil {
+			t.Errorf("branch %q should be rejected, output: %s", name, out)
+		}
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("aa"), 0644)
+	env.run("add", "a.txt")
+	out, _ = env.run("commit", "-m", "second")
+	second := commitIDFromOutput(t, out)
+	ref, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "refs", "heads", "main"))
+	if strings.TrimSpace(string(ref)) != second {
+		t.Errorf("main should point to %s, got %q", second, ref)
+	}
+	ref, _ = os.ReadFile(filepath.Join(env.tmpDir, ".fool", "refs", "heads", "feature"))
+	if strings.TrimSpace(string(ref)) != id {
+		t.Errorf("feature should still point to %s, got %q", id, ref)
+	}
+	if out, err := env.run("branch", "-d", "main"); err == nil {
+		t.Errorf("deleting the current branch should fail, output: %s", out)
+	}
+	out, err = env.run("branch", "-d", "feature")
+	if err != nil || !strings.Contains(out, "Deleted branch feature") {
+		t.Errorf("branch -d failed: %v, output: %s", err, out)
+	}
+	if out, _ = env.run("branch"); out != "* main\n" {
+		t.Errorf("unexpected branch listing after delete:\n%s", out)
+	}
+}
+
+func TestBranchSurvivesAmend(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	env.run("add", "a.txt", "b.txt")
+	out, _ := env.run("commit", "-m", "first")
+	id := commitIDFromOutput(t, out)
+	env.run("branch", "feature")
+	env.run("commit", "--amend", "-m", "x")
+	if out, err := env.run("checkout", "feature"); err != nil {
+		t.Fatalf("checkout feature failed: %v\n%s", err, out)
+	}
+	for _, f := range []string{"a.txt", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(env.tmpDir, f)); err != nil {
+			t.Errorf("%s missing after checking out the branch: %v", f, err)
+		}
+	}
+	if out, _ := env.run("log", "--oneline"); out != id[:8]+" first\n" {
+		t.Errorf("unexpected log on feature: %q", out)
+	}
+}
+
+func TestCheckoutSafety(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "base")
+	env.run("branch", "feature")
+	env.run("checkout", "feature")
+	os.WriteFile(filepath.Join(env.tmpDir, "s.txt"), []byte("feature version"), 0644)
+	env.run("add", "s.txt")
+	env.run("commit", "-m", "add s")
+	env.run("checkout", "main")
+
+	// An untracked file the target would overwrite blocks the checkout.
+	sPath := filepath.Join(env.tmpDir, "s.txt")
+	os.WriteFile(sPath, []byte("my precious untracked"), 0644)
+	if out, err := env.run("checkout", "feature"); err == nil || !strings.Contains(out, "untracked files would be overwritten") {
+		t.Errorf("checkout should refuse to overwrite s.txt: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(sPath); string(data) != "my precious untracked" {
+		t.Errorf("untracked s.txt was overwritten: %q", data)
+	}
+	os.Remove(sPath)
+
+	// Staged changes block the checkout too; --force discards them.
+	os.WriteFile(filepath.Join(env.tmpDir, "new.txt"), []byte("n"), 0644)
+	env.run("add", "new.txt")
+	if out, err := env.run("checkout", "feature"); err == nil || !strings.Contains(out, "new.txt") {
+		t.Errorf("checkout should refuse with staged changes: %v\n%s", err, out)
+	}
+	if out, err := env.run("checkout", "--force", "feature"); err != nil {
+		t.Fatalf("checkout --force failed: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index")); len(data) != 0 {
+		t.Errorf("checkout --force should clear the index: %q", data)
+	}
+
+	// A branch naming a missing commit fails without touching any file.
+	os.WriteFile(filepath.Join(env.tmpDir, ".fool", "refs", "heads", "broken"), []byte(strings.Repeat("f", 64)+"\n"), 0644)
+	if out, err := env.run("checkout", "--force", "broken"); err == nil {
+		t.Errorf("checkout of a missing commit should fail:\n%s", out)
+	}
+	for _, f := range []string{"a.txt", "s.txt"} {
+		if _, err := os.Stat(filepath.Join(env.tmpDir, f)); err != nil {
+			t.Errorf("%s should be left alone: %v", f, err)
+		}
+	}
+}
+
+func TestCheckoutBranch(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "base")
+	env.run("branch", "feature")
+	out, err := env.run("checkout", "feature")
+	if err != nil || !strings.Contains(out, "Switched to branch 'feature'") {
+		t.Fatalf("checkout feature failed: %v, output: %s", err, out)
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	env.run("add", "b.txt")
+	out, _ = env.run("commit", "-m", "add b")
+	featureTip := commitIDFromOutput(t, out)
+	if out, _ = env.run("status"); !strings.Contains(out, "On branch feature") {
+		t.Errorf("status should show the feature branch: %s", out)
+	}
+
+	out, err = env.run("checkout", "main")
+	if err != nil || !strings.Contains(out, "Removed 'b.txt'") {
+		t.Fatalf("checkout main failed: %v, output: %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("b.txt should be removed when switching to main")
+	}
+	if head, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "HEAD")); string(head) != "ref: refs/heads/main\n" {
+		t.Errorf("unexpected HEAD: %q", head)
+	}
+
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("edited"), 0644)
+	if out, err := env.run("checkout", "feature"); err == nil {
+		t.Errorf("checkout should refuse with local changes: %s", out)
+	}
+	if _, err := env.run("checkout", "--force", "feature"); err != nil {
+		t.Fatalf("checkout --force feature failed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, "b.txt")); string(data) != "b" {
+		t.Errorf("b.txt not restored on feature, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, "a.txt")); string(data) != "a" {
+		t.Errorf("a.txt not restored on feature, got %q", data)
+	}
+	if out, err := env.run("checkout", "nosuchbranch"); err == nil {
+		t.Errorf("checkout of an unknown name should fail: %s", out)
+	}
+	if out, _ = env.run("checkout", featureTip[:4]); !strings.Contains(out, "detached at "+featureTip) {
+		t.Errorf("checkout by abbreviated ID should detach HEAD: %s", out)
+	}
+}
+
+func TestTagSurvivesAmend(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "release")
+	id := commitIDFromOutput(t, out)
+	env.run("tag", "v1")
+	env.run("commit", "--amend", "-m", "release, reworded")
+	// Only the tag keeps the old commit alive once the reflog is gone.
+	os.Remove(filepath.Join(env.tmpDir, ".fool", "reflog"))
+	env.run("gc")
+	if out, err := env.run("show", "v1"); err != nil || !strings.Contains(out, "commit "+id) {
+		t.Errorf("tagged commit should survive amend and gc: %v\n%s", err, out)
+	}
+}
+
+func TestTag(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "release")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("b"), 0644)
+	env.run("add", "a.txt")
+	out, _ = env.run("commit", "-m", "more work")
+	second := commitIDFromOutput(t, out)
+
+	if out, err := env.run("tag", "v1.0", first); err != nil {
+		t.Fatalf("tag failed: %v, output: %s", err, out)
+	}
+	if out, err := env.run("tag", "latest"); err != nil {
+		t.Fatalf("tag of HEAD failed: %v, output: %s", err, out)
+	}
+	ref, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "refs", "tags", "latest"))
+	if strings.TrimSpace(string(ref)) != second {
+		t.Errorf("latest should point to HEAD %s, got %q", second, ref)
+	}
+	if out, err := env.run("tag", "v1.0"); err == nil || !strings.Contains(out, "already exists") {
+		t.Errorf("duplicate tag should fail without --force, output: %s", out)
+	}
+	if out, err := env.run("tag", "--force", "latest", first); err != nil {
+		t.Errorf("tag --force failed: %v, output: %s", err, out)
+	}
+	if out, _ = env.run("tag", "-l"); out != "latest\nv1.0\n" {
+		t.Errorf("unexpected tag listing:\n%s", out)
+	}
+	out, _ = env.run("log", "--oneline")
+	if !strings.Contains(out, first[:8]+" (tag: latest, tag: v1.0) release") || !strings.Contains(out, second[:8]+" more work") {
+		t.Errorf("log does not decorate tagged commits:\n%s", out)
+	}
+	if out, _ = env.run("log"); !strings.Contains(out, "commit "+first[:8]+" (tag: latest, tag: v1.0)\n") {
+		t.Errorf("full log does not decorate tagged commits:\n%s", out)
+	}
+	if out, err := env.run("tag", "-d", "latest"); err != nil || !strings.Contains(out, "Deleted tag 'latest'") {
+		t.Errorf("tag -d failed: %v, output: %s", err, out)
+	}
+	if out, _ = env.run("tag"); out != "v1.0\n" {
+		t.Errorf("unexpected tag listing after delete:\n%s", out)
+	}
+	if out, err := env.run("checkout", "v1.0"); err != nil || !strings.Contains(out, "detached at "+first) {
+		t.Errorf("checkout of a tag failed: %v, output: %s", err, out)
+	}
+}
+
+func TestStash(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	file := filepath.Join(env.tmpDir, "a.txt")
+	committed := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	os.WriteFile(file, []byte(committed), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "base")
+
+	if out, _ := env.run("stash"); !strings.Contains(out, "No local changes") {
+		t.Errorf("stash with a clean tree should do nothing: %s", out)
+	}
+	edited := "ONE\n-- two\n\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+	os.WriteFile(file, []byte(edited), 0644)
+	out, err := env.run("stash")
+	if err != nil || !strings.Contains(out, "stash@{0}") {
+		t.Fatalf("stash failed: %v, output: %s", err, out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != committed {
+		t.Errorf("stash did not restore the committed file, got %q", data)
+	}
+	patch, err := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "stash", "stash-0.patch"))
+	if err != nil || !strings.Contains(string(patch), "# Date: ") || !strings.Contains(string(patch), "+ONE") {
+		t.Errorf("unexpected stash patch: %v\n%s", err, patch)
+	}
+
+	os.WriteFile(file, []byte(strings.Replace(committed, "five", "FIVE", 1)), 0644)
+	env.run("stash")
+	if out, _ = env.run("stash", "list"); !strings.Contains(out, "stash@{0}: ") || !strings.Contains(out, "stash@{1}: ") || !strings.Contains(out, " on main ") {
+		t.Errorf("unexpected stash list:\n%s", out)
+	}
+	if out, err := env.run("stash", "drop", "1"); err != nil || !strings.Contains(out, "Dropped stash@{1}") {
+		t.Errorf("stash drop failed: %v, output: %s", err, out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != committed {
+		t.Errorf("stash drop should not touch the working directory, got %q", data)
+	}
+
+	out, err = env.run("stash", "pop")
+	if err != nil || !strings.Contains(out, "Dropped stash@{0}") {
+		t.Fatalf("stash pop failed: %v, output: %s", err, out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != edited {
+		t.Errorf("stash pop did not restore the changes, got %q", data)
+	}
+	if out, _ = env.run("stash", "list"); out != "" {
+		t.Errorf("stash list should be empty after pop:\n%s", out)
+	}
+	if _, err := env.run("stash", "pop"); err == nil {
+		t.Errorf("stash pop with no stashes should fail")
+	}
+}
+
+func TestStashDeletedFile(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	a, b := filepath.Join(env.tmpDir, "a"), filepath.Join(env.tmpDir, "b")
+	os.WriteFile(a, []byte("a\n"), 0644)
+	os.WriteFile(b, []byte("b\n"), 0644)
+	env.run("add", "a", "b")
+	env.run("commit", "-m", "base")
+
+	os.Remove(b)
+	os.WriteFile(a, []byte("a2\n"), 0644)
+	out, err := env.run("stash")
+	if err != nil || !strings.Contains(out, "(2 file(s))") {
+		t.Fatalf("stash failed: %v, output: %s", err, out)
+	}
+	if data, err := os.ReadFile(b); err != nil || string(data) != "b\n" {
+		t.Errorf("stash should restore the deleted file, got %q, %v", data, err)
+	}
+	out, err = env.run("stash", "pop")
+	if err != nil || !strings.Contains(out, "Deleted 'b'") {
+		t.Fatalf("stash pop failed: %v, output: %s", err, out)
+	}
+	if _, err := os.Stat(b); !os.IsNotExist(err) {
+		t.Errorf("stash pop should delete b again")
+	}
+	if data, _ := os.ReadFile(a); string(data) != "a2\n" {
+		t.Errorf("stash pop did not restore a, got %q", data)
+	}
+}
+
+func TestMv(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "src.go"), []byte("package x\n"), 0644)
+	env.run("add", "src.go")
+	env.run("commit", "-m", "add src")
+
+	out, err := env.run("mv", "src.go", "dst.go")
+	if err != nil || !strings.Contains(out, "Renamed 'src.go' to 'dst.go'") {
+		t.Fatalf("mv failed: %v, output: %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, "src.go")); !os.IsNotExist(err) {
+		t.Errorf("src.go should be gone from disk")
+	}
+	index, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	if string(index) != "rename:src.go:dst.go\n" {
+		t.Errorf("unexpected index: %q", index)
+	}
+	out, _ = env.run("status")
+	if !strings.Contains(out, "Renamed files:\n   src.go -> dst.go") || strings.Contains(out, "   dst.go\n") || strings.Contains(out, "Deleted") {
+		t.Errorf("status should show the rename only:\n%s", out)
+	}
+	if out, err := env.run("mv", "missing.go", "x.go"); err == nil {
+		t.Errorf("mv of an untracked file should fail: %s", out)
+	}
+
+	out, _ = env.run("commit", "-m", "rename")
+	id := commitIDFromOutput(t, out)
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", id, "dst.go")); err != nil {
+		t.Errorf("dst.go missing from the commit snapshot")
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", id, "src.go")); !os.IsNotExist(err) {
+		t.Errorf("src.go should not be carried into the commit snapshot")
+	}
+	meta, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", id, "meta.txt"))
+	if !strings.Contains(string(meta), "renamed: [src.go->dst.go]") {
+		t.Errorf("meta.txt does not record the rename:\n%s", meta)
+	}
+	if out, _ = env.run("log", "src.go"); !strings.Contains(out, "Renamed: [src.go->dst.go]") {
+		t.Errorf("log src.go should include the rename:\n%s", out)
+	}
+
+	os.Mkdir(filepath.Join(env.tmpDir, "pkg"), 0755)
+	env.run("mv", "dst.go", "pkg")
+	if _, err := os.Stat(filepath.Join(env.tmpDir, "pkg", "dst.go")); err != nil {
+		t.Errorf("mv into a directory should keep the file name")
+	}
+	env.run("reset", "HEAD", "pkg/dst.go")
+	if index, _ = os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index")); len(index) != 0 {
+		t.Errorf("reset should unstage the rename, index: %q", index)
+	}
+}
+
+func TestGenCommitIDUnique(t *testing.T) {
+	ts := "2025-01-01T00:00:00Z"
+	a, b := genCommitIDv2(ts, "same message"), genCommitIDv2(ts, "same message")
+	if a == b {
+		t.Errorf("identical inputs produced the same ID %s", a)
+	}
+	if len(a) != 64 || len(b) != 64 {
+		t.Errorf("IDs should be 64 hex characters, got %q and %q", a, b)
+	}
+}
+
+func TestLogGrep(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	for i, msg := range []string{"Fix parser crash", "Add parser tests", "fix typo in docs"} {
+		os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte(fmt.Sprint(i)), 0644)
+		env.run("add", "a.txt")
+		env.run("commit", "-m", msg)
+	}
+	cases := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--grep", "^Fix"}, []string{"Fix parser crash"}},
+		{[]string{"--grep", "^fix", "-i"}, []string{"fix typo in docs", "Fix parser crash"}},
+		{[]string{"--grep", "typo", "--grep", "tests"}, []string{"fix typo in docs", "Add parser tests"}},
+		{[]string{"--grep", "parser", "--grep", "tests", "--all-match"}, []string{"Add parser tests"}},
+		{[]string{"--grep", "nothing"}, nil},
+	}
+	for _, c := range cases {
+		out, err := env.run(append([]string{"log", "--oneline"}, c.args...)...)
+		if err != nil {
+			t.Fatalf("log %v failed: %v, output: %s", c.args, err, out)
+		}
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			if line != "" {
+				got = append(got, line[9:])
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("log %v = %q, want %q", c.args, got, c.want)
+		}
+	}
+	if out, err := env.run("log", "--grep", "("); err == nil || !strings.Contains(out, "invalid --grep pattern") {
+		t.Errorf("invalid pattern should abort, output: %s", out)
+	}
+}
+
+func TestLogAuthor(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	authors := []string{"Alice <alice@example.com>", "Bob <bob@corp.test>", "Carol <carol@example.com>"}
+	for i, author := range authors {
+		os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte(fmt.Sprint(i)), 0644)
+		env.run("add", "a.txt")
+		env.run("commit", "--author", author, "-m", fmt.Sprintf("change %d by %s", i, author[:strings.Index(author, " ")]))
+	}
+	cases := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--author", "Alice"}, []string{"change 0 by Alice"}},
+		{[]string{"--author", "example.com"}, []string{"change 2 by Carol", "change 0 by Alice"}},
+		{[]string{"--author", "bob", "-i"}, []string{"change 1 by Bob"}},
+		{[]string{"--author", "Bob", "--author", "Carol"}, []string{"change 2 by Carol", "change 1 by Bob"}},
+		{[]string{"--author", "example", "--grep", "Carol"}, []string{"change 2 by Carol"}},
+		{[]string{"--author", "["}, nil},
+	}
+	for _, c := range cases {
+		out, err := env.run(append([]string{"log", "--oneline"}, c.args...)...)
+		if err != nil {
+			t.Fatalf("log %v failed: %v, output: %s", c.args, err, out)
+		}
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			if line != "" {
+				got = append(got, line[9:])
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("log %v = %q, want %q", c.args, got, c.want)
+		}
+	}
+}
+
+func TestStatusShort(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	for _, f := range []string{"a.txt", "b.txt"} {
+		os.WriteFile(filepath.Join(env.tmpDir, f), []byte(f), 0644)
+		env.run("add", f)
+	}
+	env.run("commit", "-m", "base")
+	if out, err := env.run("status", "--short"); err != nil || out != "?  fool\n" {
+		t.Errorf("clean tree should exit 0 with only untracked files listed: %v, output: %q", err, out)
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("changed"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "c.txt"), []byte("c"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "d.txt"), []byte("d"), 0644)
+	env.run("add", "c.txt")
+	env.run("rm", "b.txt")
+	out, err := env.run("status", "--porcelain")
+	want := "A  c.txt\nD  b.txt\nM  a.txt\n?  d.txt\n?  fool\n"
+	if err == nil || out != want {
+		t.Errorf("status --porcelain = %q (err %v), want %q and a non-zero exit", out, err, want)
+	}
+
+	force := []string{"FOOL_COLOR=always", "NO_COLOR="}
+	if out, _ := env.runEnv(force, "status", "--short"); !strings.Contains(out, "\033[") {
+		t.Errorf("FOOL_COLOR=always should color status --short:\n%q", out)
+	}
+	if out, _ := env.runEnv(force, "status", "--porcelain"); out != want {
+		t.Errorf("status --porcelain must never be colored, got %q", out)
+	}
+}
+
+func TestStatusSubdirectories(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.MkdirAll(filepath.Join(env.tmpDir, "pkg", "util"), 0755)
+	os.MkdirAll(filepath.Join(env.tmpDir, "cmd"), 0755)
+	os.WriteFile(filepath.Join(env.tmpDir, "pkg", "util", "u.go"), []byte("u"), 0644)
+	env.run("add", "pkg/util/u.go")
+	env.run("commit", "-m", "base")
+	os.WriteFile(filepath.Join(env.tmpDir, ".foolignore"), []byte("fool\n*.o\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "pkg", "util", "u.go"), []byte("changed"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "pkg", "util", "u.o"), []byte("o"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "pkg", "new.go"), []byte("n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "cmd", "main.go"), []byte("m"), 0644)
+	out, _ := env.run("status", "--short")
+	want := "M  pkg/util/u.go\n?  .foolignore\n?  cmd/main.go\n?  pkg/new.go\n"
+	if out != want {
+		t.Errorf("status --short = %q, want %q", out, want)
+	}
+}
+
+func TestInitDirectory(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	out, err := env.run("init", "nested/project")
+	if err != nil {
+		t.Fatalf("init <dir> failed: %v, output: %s", err, out)
+	}
+	repo := filepath.Join(env.tmpDir, "nested", "project", ".fool")
+	if _, err := os.Stat(repo); err != nil {
+		t.Fatalf("repository not created: %v", err)
+	}
+	printed := strings.TrimSpace(strings.TrimPrefix(out, "Initialized empty fool repository in "))
+	if !filepath.IsAbs(printed) || !strings.HasSuffix(printed, filepath.Join("nested", "project", ".fool")+string(filepath.Separator)) {
+		t.Errorf("init should print the absolute repository path, got: %s", out)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool")); !os.IsNotExist(err) {
+		t.Errorf("init <dir> should not create a repository in the current directory")
+	}
+	if out, err := env.run("status"); err == nil {
+		t.Errorf("status outside a repository should fail, output: %s", out)
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "nested", "project", "a.txt"), []byte("a"), 0644)
+	if out, err := env.run("-C", "nested/project", "add", "a.txt"); err != nil {
+		t.Errorf("add with -C failed: %v, output: %s", err, out)
+	}
+	if out, _ := env.run("-C", "nested/project", "status"); !strings.Contains(out, "Staged files:\n   a.txt") {
+		t.Errorf("status with -C does not see the staged file:\n%s", out)
+	}
+}
+
+func TestCommitAll(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	for _, f := range []string{"a.txt", "b.txt"} {
+		os.WriteFile(filepath.Join(env.tmpDir, f), []byte(f), 0644)
+		env.run("add", f)
+	}
+	env.run("commit", "-m", "base")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("changed"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "new.txt"), []byte("new"), 0644)
+	out, err := env.run("commit", "-a", "-m", "fix typo")
+	if err != nil || !strings.Contains(out, "Committed 1 file(s)") {
+		t.Fatalf("commit -a failed: %v, output: %s", err, out)
+	}
+	id := commitIDFromOutput(t, out)
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", id, "a.txt")); string(data) != "changed" {
+		t.Errorf("modified file not committed, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", id, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("untracked files must not be committed by -a")
+	}
+	if out, _ = env.run("commit", "-a", "-m", "nothing"); !strings.Contains(out, "Nothing to commit") {
+		t.Errorf("commit -a on a clean tree should do nothing: %s", out)
+	}
+}
+
+func TestCommitMessageFile(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	os.WriteFile(filepath.Join(env.tmpDir, "empty.txt"), []byte(" \n\n"), 0644)
+	if out, _ := env.run("commit", "-F", "empty.txt"); !strings.Contains(out, "Aborting commit due to empty commit message.") {
+		t.Errorf("empty message file should abort: %s", out)
+	}
+	msgFile := filepath.Join(env.tmpDir, "COMMIT_MSG.txt")
+	os.WriteFile(msgFile, []byte("Subject line\n\n- first point\n- second point\n"), 0644)
+	if out, _ := env.run("commit", "-F", "COMMIT_MSG.txt", "-m", "x"); !strings.Contains(out, "cannot be combined") {
+		t.Errorf("-F and -m together should fail: %s", out)
+	}
+	out, err := env.run("commit", "-F", "COMMIT_MSG.txt")
+	if err != nil {
+		t.Fatalf("commit -F failed: %v, output: %s", err, out)
+	}
+	id := commitIDFromOutput(t, out)
+	meta, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", id, "meta.txt"))
+	if !strings.Contains(string(meta), "message: Subject line\n    \n    - first point\n    - second point\nfiles:") {
+		t.Errorf("unexpected meta.txt:\n%s", meta)
+	}
+}
+
+func TestRevert(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	file := filepath.Join(env.tmpDir, "a.txt")
+	base := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	os.WriteFile(file, []byte(base), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "base")
+
+	os.WriteFile(file, []byte(strings.Replace(base, "2\n", "two\n", 1)), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b"), 0644)
+	env.run("add", "a.txt", "b.txt")
+	out, _ := env.run("commit", "-m", "bad change")
+	bad := commitIDFromOutput(t, out)
+
+	os.WriteFile(file, []byte(strings.Replace(strings.Replace(base, "2\n", "two\n", 1), "9\n", "nine\n", 1)), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "good change")
+
+	out, err := env.run("revert", bad)
+	if err != nil || !strings.Contains(out, "Committed 1 file(s) and 1 deletion(s)") {
+		t.Fatalf("revert failed: %v, output: %s", err, out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != strings.Replace(base, "9\n", "nine\n", 1) {
+		t.Errorf("revert should undo only the reverted commit's change, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("b.txt added by the reverted commit should be removed")
+	}
+	if out, _ = env.run("log", "-1"); !strings.Contains(out, "Message: Revert \"bad change\"") || !strings.Contains(out, "This reverts commit "+bad+".") {
+		t.Errorf("unexpected revert commit:\n%s", out)
+	}
+
+	os.WriteFile(file, []byte("rewritten\n"), 0644)
+	env.run("commit", "-a", "-m", "rewrite")
+	if out, err := env.run("revert", bad); err == nil || !strings.Contains(out, "   a.txt") {
+		t.Errorf("revert of a conflicting commit should fail and list a.txt, output: %s", out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "rewritten\n" {
+		t.Errorf("a failed revert must not touch the working directory, got %q", data)
+	}
+}
+
+func TestCommitParent(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	meta, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", first, "meta.txt"))
+	if !strings.Contains(string(meta), "parent: none\n") {
+		t.Errorf("initial commit should have parent none:\n%s", meta)
+	}
+	env.run("branch", "feature")
+	env.run("checkout", "feature")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("feature"), 0644)
+	out, _ = env.run("commit", "-a", "-m", "on feature")
+	feature := commitIDFromOutput(t, out)
+	wd, _ := os.Getwd()
+	os.Chdir(env.tmpDir)
+	c, err := loadCommit(feature)
+	os.Chdir(wd)
+	if err != nil || c.Parent != first || c.Message != "on feature" || len(c.Files) != 1 || c.Date.IsZero() {
+		t.Errorf("loadCommit(%s) = %+v, %v", feature, c, err)
+	}
+
+	env.run("checkout", "main")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("main"), 0644)
+	out, _ = env.run("commit", "-a", "-m", "on main")
+	onMain := commitIDFromOutput(t, out)
+	meta, _ = os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", onMain, "meta.txt"))
+	if !strings.Contains(string(meta), "parent: "+first+"\n") {
+		t.Errorf("commit on main should have the branch point as parent:\n%s", meta)
+	}
+	out, _ = env.run("log", "--oneline")
+	if strings.Contains(out, "on feature") || !strings.Contains(out, "on main") || !strings.Contains(out, "first") {
+		t.Errorf("log should follow the parents of main only:\n%s", out)
+	}
+}
+
+func TestCherryPick(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	file := filepath.Join(env.tmpDir, "a.txt")
+	base := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	os.WriteFile(file, []byte(base), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "only-main.txt"), []byte("x"), 0644)
+	env.run("add", "a.txt", "only-main.txt")
+	env.run("commit", "-m", "base")
+	env.run("branch", "release")
+
+	os.WriteFile(file, []byte(strings.Replace(base, "9\n", "nine\n", 1)), 0644)
+	env.run("commit", "-a", "-m", "unrelated work")
+	os.WriteFile(file, []byte(strings.Replace(strings.Replace(base, "9\n", "nine\n", 1), "2\n", "two (fixed)\n", 1)), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "only-main.txt"), []byte("y"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "new.txt"), []byte("new"), 0644)
+	env.run("add", "a.txt", "only-main.txt", "new.txt")
+	out, _ := env.run("commit", "-m", "fix bug")
+	fix := commitIDFromOutput(t, out)
+
+	env.run("checkout", "release")
+	env.run("rm", "only-main.txt")
+	env.run("commit", "-m", "drop only-main.txt")
+	out, err := env.run("cherry-pick", fix)
+	if err != nil || !strings.Contains(out, "Warning: 'only-main.txt' does not exist on this branch, skipping.") {
+		t.Fatalf("cherry-pick failed: %v, output: %s", err, out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != strings.Replace(base, "2\n", "two (fixed)\n", 1) {
+		t.Errorf("cherry-pick should apply only the picked change, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, "new.txt")); string(data) != "new" {
+		t.Errorf("file added by the picked commit is missing, got %q", data)
+	}
+	if out, _ = env.run("log", "-1", "--oneline"); !strings.Contains(out, "cherry-picked from "+fix+": fix bug") {
+		t.Errorf("unexpected cherry-pick commit:\n%s", out)
+	}
+	if out, _ = env.run("log", "--oneline"); strings.Contains(out, "unrelated work") {
+		t.Errorf("release should not contain commits from main:\n%s", out)
+	}
+}
+
+func TestBlame(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	file := filepath.Join(env.tmpDir, "a.txt")
+	os.WriteFile(file, []byte("one\ntwo\nthree\n"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(file, []byte("one\n2\nthree\nfour\n"), 0644)
+	out, _ = env.run("commit", "-a", "-m", "second")
+	second := commitIDFromOutput(t, out)
+	os.WriteFile(file, []byte("one\n2\nthree\nfour\nfive\n"), 0644)
+
+	out, err := env.run("blame", "a.txt")
+	if err != nil {
+		t.Fatalf("blame failed: %v, output: %s", err, out)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	want := []struct{ id, text string }{{first[:8], "one"}, {second[:8], "2"}, {first[:8], "three"}, {second[:8], "four"}, {"00000000", "five"}}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got:\n%s", len(want), out)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w.id+" ") || !strings.HasSuffix(lines[i], " "+w.text) || len(lines[i]) != len(w.id)+21+len(w.text) {
+			t.Errorf("line %d = %q, want commit %s and text %q in fixed-width columns", i+1, lines[i], w.id, w.text)
+		}
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "new.txt"), []byte("x"), 0644)
+	if out, err := env.run("blame", "new.txt"); err == nil || !strings.Contains(out, "never been committed") {
+		t.Errorf("blame of an uncommitted file should fail, output: %s", out)
+	}
+}
+
+func TestGrep(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.go"), []byte("package a\n\nconst MaxSize = 10\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "bin.dat"), []byte("MaxSize\x00"), 0644)
+	env.run("add", "a.go", "bin.dat")
+	out, _ := env.run("commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.go"), []byte("package a\n\nconst Limit = 10\n"), 0644)
+	env.run("commit", "-a", "-m", "rename constant")
+
+	if out, err := env.run("grep", "MaxSize"); err == nil || strings.Contains(out, "a.go:") {
+		t.Errorf("HEAD should not contain MaxSize: %v, output: %s", err, out)
+	}
+	out, err := env.run("grep", "--ignore-case", "maxsize", first)
+	if err != nil || !strings.Contains(out, "a.go:3:const MaxSize = 10\n") || !strings.Contains(out, "Binary file bin.dat skipped") {
+		t.Errorf("grep in an old commit failed: %v, output: %s", err, out)
+	}
+	if out, err = env.run("grep", "("); err == nil || !strings.Contains(out, "invalid pattern") {
+		t.Errorf("invalid pattern should fail: %s", out)
+	}
+}
+
+func TestClean(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	write := func(name string) {
+		path := filepath.Join(env.tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(name), 0644)
+	}
+	// The test binary lives in the work tree, so keep it out of reach.
+	os.WriteFile(filepath.Join(env.tmpDir, ".foolignore"), []byte("fool\n*.log\n"), 0644)
+	write("tracked.txt")
+	write("src/main.go")
+	env.run("add", "tracked.txt", ".foolignore", "src/main.go")
+	env.run("commit", "-m", "base")
+	write("staged.txt")
+	env.run("add", "staged.txt")
+	write("build.o")
+	write("debug.log")
+	write("out/gen.txt")
+	write("out/deep/more.txt")
+	write("src/scratch.go")
+
+	out, _ := env.run("clean")
+	if out != "Would remove build.o\nWould remove src/scratch.go\nNothing removed; use -f to delete these files.\n" {
+		t.Errorf("unexpected clean output:\n%s", out)
+	}
+	if out, _ = env.run("clean", "-n", "-d"); out != "Would remove build.o\nWould remove out/\nWould remove src/scratch.go\n" {
+		t.Errorf("unexpected clean -n -d output:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, "build.o")); err != nil {
+		t.Errorf("clean without -f must not remove anything")
+	}
+	env.run("clean", "-f", "-d")
+	for _, gone := range []string{"build.o", "out", "src/scratch.go"} {
+		if _, err := os.Stat(filepath.Join(env.tmpDir, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed", gone)
+		}
+	}
+	for _, kept := range []string{"tracked.txt", "staged.txt", "src/main.go", "debug.log", "fool"} {
+		if _, err := os.Stat(filepath.Join(env.tmpDir, kept)); err != nil {
+			t.Errorf("%s should have been kept", kept)
+		}
+	}
+	if out, _ = env.run("clean", "-n", "-x"); !strings.Contains(out, "Would remove debug.log") {
+		t.Errorf("clean -x should include ignored files:\n%s", out)
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.MkdirAll(filepath.Join(env.tmpDir, "src"), 0755)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "b.txt"), []byte("b"), 0644)
+	env.run("add", "a.txt", "src/b.txt")
+	out, _ := env.run("commit", "-m", "release")
+	id := commitIDFromOutput(t, out)
+
+	wd, _ := os.Getwd()
+	os.Chdir(env.tmpDir)
+	defer os.Chdir(wd)
+	want := map[string]string{"a.txt": "a", "src/b.txt": "b"}
+	readTar := func(r io.Reader) map[string]string {
+		got := map[string]string{}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(tr)
+			got[hdr.Name] = string(data)
+		}
+		return got
+	}
+	check := func(name string, got map[string]string) {
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s contains %v, want %v", name, got, want)
+		}
+	}
+
+	if err := writeArchive(id, "out.tar", ""); err != nil {
+		t.Fatalf("writeArchive tar: %v", err)
+	}
+	f, _ := os.Open("out.tar")
+	check("out.tar", readTar(f))
+	f.Close()
+
+	if err := writeArchive(id, "out.tgz", ""); err != nil {
+		t.Fatalf("writeArchive tgz: %v", err)
+	}
+	f, _ = os.Open("out.tgz")
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("out.tgz is not gzipped: %v", err)
+	}
+	check("out.tgz", readTar(gz))
+	f.Close()
+
+	if err := writeArchive(id, "out.bin", "zip"); err != nil {
+		t.Fatalf("writeArchive zip: %v", err)
+	}
+	zr, err := zip.OpenReader("out.bin")
+	if err != nil {
+		t.Fatalf("out.bin is not a zip file: %v", err)
+	}
+	got := map[string]string{}
+	for _, zf := range zr.File {
+		rc, _ := zf.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got[zf.Name] = string(data)
+	}
+	zr.Close()
+	check("out.bin", got)
+
+	if err := writeArchive(id, "out.rar", "rar"); err == nil {
+		t.Errorf("unknown formats should be rejected")
+	}
+}
+
+func TestGC(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "keep")
+	kept := commitIDFromOutput(t, out)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("abc"), 0644)
+	out, _ = env.run("commit", "-a", "-m", "drop")
+	dropped := commitIDFromOutput(t, out)
+	env.run("reset", "--soft")
+	env.run("reset", "HEAD")
+
+	if out, _ = env.run("gc", "--dry-run"); strings.Contains(out, dropped) {
+		t.Errorf("commits in the reflog must be kept:\n%s", out)
+	}
+	env.run("reflog", "expire")
+	os.Remove(filepath.Join(env.tmpDir, ".fool", "reflog"))
+	remoteRef := filepath.Join(env.tmpDir, ".fool", "refs", "remotes", "origin", "main")
+	os.MkdirAll(filepath.Dir(remoteRef), 0755)
+	os.WriteFile(remoteRef, []byte(dropped+"\n"), 0644)
+	if out, _ = env.run("gc", "--dry-run"); strings.Contains(out, dropped) {
+		t.Errorf("commits remote-tracking refs reach must be kept:\n%s", out)
+	}
+	os.RemoveAll(filepath.Join(env.tmpDir, ".fool", "refs", "remotes"))
+	out, _ = env.run("gc", "--dry-run")
+	if !strings.Contains(out, "Would remove "+dropped) || strings.Contains(out, kept) {
+		t.Errorf("unexpected gc --dry-run output:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", dropped)); err != nil {
+		t.Errorf("gc --dry-run must not remove anything")
+	}
+	out, _ = env.run("gc")
+	if !strings.Contains(out, "Removed 1 unreachable objects, freed ") {
+		t.Errorf("unexpected gc output:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", dropped)); !os.IsNotExist(err) {
+		t.Errorf("unreachable commit %s should be removed", dropped)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "objects", kept)); err != nil {
+		t.Errorf("reachable commit %s must be kept", kept)
+	}
+}
+
+func TestCountObjects(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "keep")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("abc"), 0644)
+	out, _ := env.run("commit", "-a", "-m", "drop")
+	dropped := commitIDFromOutput(t, out)
+	env.run("reset", "--soft")
+	os.Remove(filepath.Join(env.tmpDir, ".fool", "reflog"))
+
+	out, err := env.run("count-objects", "--json")
+	if err != nil {
+		t.Fatalf("count-objects --json failed: %v\n%s", err, out)
+	}
+	var counts struct {
+		Commits     int   `json:"commits"`
+		Blobs       int   `json:"blobs"`
+		SizeBytes   int64 `json:"size_bytes"`
+		Unreachable int   `json:"unreachable"`
+	}
+	if err := json.Unmarshal([]byte(out), &counts); err != nil {
+		t.Fatalf("count-objects --json printed invalid JSON: %v\n%s", err, out)
+	}
+	if counts.Commits != 2 || counts.Blobs != 0 || counts.Unreachable != 1 || counts.SizeBytes == 0 {
+		t.Errorf("unexpected counts: %+v", counts)
+	}
+	out, _ = env.run("count-objects", "-v")
+	if !strings.Contains(out, dropped[:8]+" ") || !strings.Contains(out, "(unreachable)") || !strings.Contains(out, "commits: 2\n") {
+		t.Errorf("unexpected count-objects -v output:\n%s", out)
+	}
+}
+
+func TestIndexLock(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	lockPath := filepath.Join(env.tmpDir, ".fool", "index.lock")
+	os.WriteFile(lockPath, nil, 0644)
+	out, err := env.run("add", "a.txt")
+	if err == nil || !strings.Contains(out, "index is locked by another process") {
+		t.Fatalf("add should fail while the index is locked, got: %v\n%s", err, out)
+	}
+	os.Remove(lockPath)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("f%d.txt", i)
+		os.WriteFile(filepath.Join(env.tmpDir, name), []byte(name), 0644)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			env.run("add", name)
+		}()
+	}
+	wg.Wait()
+	index, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "index"))
+	for i := 0; i < 5; i++ {
+		if !strings.Contains(string(index), fmt.Sprintf("f%d.txt\n", i)) {
+			t.Errorf("f%d.txt missing from index after concurrent adds:\n%s", i, index)
+		}
+	}
+	for _, leftover := range []string{"index.lock", "index.tmp"} {
+		if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", leftover)); !os.IsNotExist(err) {
+			t.Errorf(".fool/%s should not be left behind", leftover)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	if _, err := env.run("config", "user.name"); err == nil {
+		t.Errorf("reading an unset key should fail")
+	}
+	env.run("config", "user.name", "Alice")
+	env.run("config", "User.Email", "alice@example.com")
+	env.run("config", "remote.origin.url", "/srv/repo")
+	if out, _ := env.run("config", "user.name"); out != "Alice\n" {
+		t.Errorf("expected 'Alice', got %q", out)
+	}
+	out, _ := env.run("config", "--list")
+	want := "core.repositoryformatversion=0\nremote.origin.url=/srv/repo\nuser.email=alice@example.com\nuser.name=Alice\n"
+	if out != want {
+		t.Errorf("unexpected config --list output:\n%s", out)
+	}
+	data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "config"))
+	if !strings.Contains(string(data), "[user]\n") || !strings.Contains(string(data), "[remote \"origin\"]\n") {
+		t.Errorf("unexpected .fool/config:\n%s", data)
+	}
+
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ = env.run("commit", "-m", "first")
+	id := commitIDFromOutput(t, out)
+	meta, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", id, "meta.txt"))
+	if !strings.Contains(string(meta), "author.name: Alice\n") {
+		t.Errorf("commit should use the configured author:\n%s", meta)
+	}
+}
+
+func TestLogStat(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a\nb\nc\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "long.go"), []byte("x\n"), 0644)
+	env.run("add", "a.txt", "long.go")
+	env.run("commit", "-m", "first")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a\nB\nc\nd\n"), 0644)
+	env.run("commit", "-a", "-m", "second")
+
+	out, _ := env.run("log", "--stat", "-n", "1")
+	want := " a.txt | 3 ++-\n 1 file changed, 2 insertions(+), 1 deletion(-)\n"
+	if !strings.HasSuffix(out, want) || strings.Contains(out, "Files:") {
+		t.Errorf("unexpected log --stat output:\n%s", out)
+	}
+	out, _ = env.run("log", "--stat", "--oneline")
+	if !strings.Contains(out, " a.txt   | 3 +++\n long.go | 1 +\n 2 files changed, 4 insertions(+)\n") {
+		t.Errorf("unexpected stat for the first commit:\n%s", out)
+	}
+}
+
+func TestComputeFileStat(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	os.WriteFile(oldPath, []byte("1\n2\n3\n"), 0644)
+	os.WriteFile(newPath, []byte("1\n3\n4\n5\n"), 0644)
+	if added, removed, err := computeFileStat(oldPath, newPath); err != nil || added != 2 || removed != 1 {
+		t.Errorf("got +%d -%d (%v), want +2 -1", added, removed, err)
+	}
+	if added, removed, err := computeFileStat("", newPath); err != nil || added != 4 || removed != 0 {
+		t.Errorf("got +%d -%d (%v) for a new file, want +4 -0", added, removed, err)
+	}
+	os.WriteFile(newPath, []byte{0, 1, 2}, 0644)
+	if _, _, err := computeFileStat(oldPath, newPath); err != errBinaryFile {
+		t.Errorf("expected errBinaryFile, got %v", err)
+	}
+}
+
+func TestLogPatch(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a\nb\n"), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "first")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a\nc\n"), 0644)
+	env.run("commit", "-a", "-m", "second")
+
+	out, _ := env.run("log", "-p", "--stat", "-n", "1")
+	want := " a.txt | 2 +-\n 1 file changed, 1 insertion(+), 1 deletion(-)\n" +
+		"--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("unexpected log -p --stat output:\n%s", out)
+	}
+	out, _ = env.run("log", "-p")
+	if !strings.Contains(out, "--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n") {
+		t.Errorf("log -p should show the root commit adding a.txt:\n%s", out)
+	}
+}
+
+func TestLogAbbrev(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "first")
+	id := commitIDFromOutput(t, out)
+	if len(id) != 64 {
+		t.Fatalf("expected a full SHA-256 commit ID, got %q", id)
+	}
+	if out, _ := env.run("log", "--oneline", "--abbrev=12"); out != id[:12]+" first\n" {
+		t.Errorf("unexpected log --abbrev=12 output: %q", out)
+	}
+	if out, _ := env.run("log", "--abbrev=0"); !strings.HasPrefix(out, "commit "+id+"\n") {
+		t.Errorf("log --abbrev=0 should show the full ID:\n%s", out)
+	}
+	if out, err := env.run("show", id[:8]); err != nil || !strings.Contains(out, "commit "+id) {
+		t.Errorf("show should resolve an 8-character prefix: %v\n%s", err, out)
+	}
+}
+
+func TestLogReverse(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	var ids []string
+	for _, msg := range []string{"one", "two", "three"} {
+		os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte(msg), 0644)
+		env.run("add", "a.txt")
+		out, _ := env.run("commit", "-m", msg)
+		ids = append(ids, commitIDFromOutput(t, out))
+	}
+	out, _ := env.run("log", "--oneline", "--reverse")
+	want := ids[0][:8] + " one\n" + ids[1][:8] + " two\n" + ids[2][:8] + " three\n"
+	if out != want {
+		t.Errorf("unexpected log --reverse output:\n%s\nwant:\n%s", out, want)
+	}
+	out, _ = env.run("log", "--oneline", "--reverse", "-n", "2")
+	if out != ids[0][:8]+" one\n"+ids[1][:8]+" two\n" {
+		t.Errorf("log --reverse -n 2 should show the two oldest commits:\n%s", out)
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "--author", "Ada <ada@example.com>", "-m", "first")
+	id := commitIDFromOutput(t, out)
+	out, err := env.run("log", "--format={{.ID}} {{.Author}} {{.Message}}")
+	if err != nil || out != id+" Ada <ada@example.com> first\n" {
+		t.Errorf("unexpected log --format output: %v %q", err, out)
+	}
+	if out, _ := env.run("log", "--format=oneline"); out != id[:8]+" first\n" {
+		t.Errorf("unexpected --format=oneline output: %q", out)
+	}
+	out, _ = env.run("log", "--format=fuller", "--date=unix")
+	for _, want := range []string{"commit " + id + "\n", "Author: Ada <ada@example.com>\n", "Date:   1", "Files: a.txt\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("--format=fuller output missing %q:\n%s", want, out)
+		}
+	}
+	if out, err := env.run("log", "--format={{.ID"); err == nil || !strings.Contains(out, "invalid --format template") {
+		t.Errorf("expected a template parse error, got %v: %s", err, out)
+	}
+}
+
+func TestShowFile(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.MkdirAll(filepath.Join(env.tmpDir, "src"), 0755)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "main.go"), []byte("v1\n"), 0644)
+	env.run("add", "src/main.go")
+	out, _ := env.run("commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "main.go"), []byte("v2\n"), 0644)
+	env.run("add", "src/main.go")
+	env.run("commit", "-m", "second")
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "main.go"), []byte("worktree\n"), 0644)
+
+	if out, err := env.run("show", first[:8]+":src/main.go"); err != nil || out != "v1\n" {
+		t.Errorf("unexpected show <id>:<path> output: %v %q", err, out)
+	}
+	if out, err := env.run("show", "HEAD:src/main.go"); err != nil || out != "v2\n" {
+		t.Errorf("unexpected show HEAD:<path> output: %v %q", err, out)
+	}
+	for _, arg := range []string{"HEAD:missing.txt", "HEAD:src", "HEAD:meta.txt", "HEAD:../x"} {
+		if out, err := env.run("show", arg); err == nil {
+			t.Errorf("show %s should fail, got: %s", arg, out)
+		}
+	}
+}
+
+func TestResolveHEAD(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(env.tmpDir)
+	defer os.Chdir(wd)
+	if id, err := resolveHEAD(); err == nil {
+		t.Errorf("expected an error before the first commit, got %q", id)
+	}
+	os.WriteFile("a.txt", []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "first")
+	id := commitIDFromOutput(t, out)
+	if got, err := resolveHEAD(); err != nil || got != id {
+		t.Errorf("resolveHEAD() = %q, %v, want %q", got, err, id)
+	}
+	// HEAD may point at a symbolic ref that itself points at the branch.
+	os.WriteFile(filepath.Join(".fool", "refs", "current"), []byte("ref: refs/heads/main\n"), 0644)
+	os.WriteFile(filepath.Join(".fool", "HEAD"), []byte("ref: refs/current\n"), 0644)
+	if got, err := resolveHEAD(); err != nil || got != id {
+		t.Errorf("resolveHEAD() through a symbolic ref = %q, %v, want %q", got, err, id)
+	}
+	os.WriteFile(filepath.Join(".fool", "refs", "current"), []byte("ref: refs/current\n"), 0644)
+	if _, err := resolveHEAD(); err == nil {
+		t.Errorf("expected an error for a symbolic ref cycle")
+	}
+}
+
+func TestLsFiles(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.MkdirAll(filepath.Join(env.tmpDir, "src"), 0755)
+	for _, f := range []string{"a.txt", "b.txt", "src/c.txt"} {
+		os.WriteFile(filepath.Join(env.tmpDir, f), []byte(f), 0644)
+		env.run("add", f)
+	}
+	env.run("commit", "-m", "base")
+	os.WriteFile(filepath.Join(env.tmpDir, ".foolignore"), []byte("fool\n*.o\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("changed"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "src", "new.txt"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "x.o"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "staged.txt"), []byte("s"), 0644)
+	env.run("add", "staged.txt")
+	env.run("rm", "--cached", "a.txt")
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{nil, "b.txt\nsrc/c.txt\nstaged.txt\n"},
+		{[]string{"--others"}, ".foolignore\na.txt\nsrc/new.txt\n"},
+		{[]string{"--modified"}, "b.txt\n"},
+		{[]string{"--cached", "--modified", "--others"}, ".foolignore\na.txt\nb.txt\nsrc/c.txt\nsrc/new.txt\nstaged.txt\n"},
+	}
+	for _, c := range cases {
+		out, err := env.run(append([]string{"ls-files"}, c.args...)...)
+		if err != nil || out != c.want {
+			t.Errorf("ls-files %v = %q, %v, want %q", c.args, out, err, c.want)
+		}
+	}
+}
+
+func TestCatFile(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "--author", "Ada <ada@example.com>", "-m", "first")
+	id := commitIDFromOutput(t, out)
+	meta, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", id, "meta.txt"))
+	if out, err := env.run("cat-file", id[:4]); err != nil || out != string(meta) {
+		t.Errorf("cat-file should print meta.txt verbatim, got %v:\n%s", err, out)
+	}
+	if out, _ := env.run("cat-file", "-t", "HEAD"); out != "commit\n" {
+		t.Errorf("unexpected cat-file -t output: %q", out)
+	}
+	out, _ = env.run("cat-file", "-p", id)
+	for _, want := range []string{"commit   " + id + "\n", "author   Ada <ada@example.com>\n", "files    a.txt\n", "\n    first\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("cat-file -p output missing %q:\n%s", want, out)
+		}
+	}
+	if out, err := env.run("cat-file", "zzzz"); err == nil {
+		t.Errorf("cat-file of an unknown commit should fail: %s", out)
+	}
+}
+
+func TestHashObject(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("hello\n"), 0644)
+	out, err := env.run("hash-object", "a.txt")
+	want := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03\n"
+	if err != nil || out != want {
+		t.Errorf("hash-object = %q, %v, want %q", out, err, want)
+	}
+	if out, err := env.run("hash-object", "missing.txt"); err == nil {
+		t.Errorf("hash-object of a missing file should fail: %s", out)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool")); !os.IsNotExist(err) {
+		t.Errorf("hash-object without --write should not touch the repository")
+	}
+
+	env.run("init")
+	out, err = env.run("hash-object", "--write", "a.txt")
+	if err != nil || out != want {
+		t.Fatalf("hash-object --write = %q, %v, want %q", out, err, want)
+	}
+	blob := filepath.Join(env.tmpDir, ".fool", "objects", "blobs", strings.TrimSpace(want))
+	if data, err := os.ReadFile(blob); err != nil || string(data) != "hello\n" {
+		t.Errorf("--write should store the blob, got %q, %v", data, err)
+	}
+	if out, _ := env.run("count-objects"); !strings.Contains(out, "commits: 0\nblobs: 1\n") {
+		t.Errorf("count-objects should count the blob and not as a commit:\n%s", out)
+	}
+	if out, _ := env.run("gc"); !strings.Contains(out, "Removed 0 unreachable objects") {
+		t.Errorf("gc should leave blobs alone:\n%s", out)
+	}
+	if _, err := os.Stat(blob); err != nil {
+		t.Errorf("gc removed the blob: %v", err)
+	}
+}
+
+func TestMergeFastForward(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a\n"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "base")
+	base := commitIDFromOutput(t, out)
+	env.run("branch", "feature")
+	env.run("checkout", "feature")
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b\n"), 0644)
+	env.run("add", "b.txt")
+	out, _ = env.run("commit", "-m", "feature work")
+	tip := commitIDFromOutput(t, out)
+	env.run("checkout", "main")
+
+	out, err := env.run("merge", "feature")
+	if err != nil || !strings.Contains(out, "Fast-forward") {
+		t.Fatalf("merge failed: %v\n%s", err, out)
+	}
+	if data, err := os.ReadFile(filepath.Join(env.tmpDir, "b.txt")); err != nil || string(data) != "b\n" {
+		t.Errorf("merge should restore b.txt, got %q (%v)", data, err)
+	}
+	ref, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "refs", "heads", "main"))
+	if strings.TrimSpace(string(ref)) != tip {
+		t.Errorf("main should point to %s, got %q", tip, ref)
+	}
+	if out, _ := env.run("merge", "feature"); !strings.Contains(out, "Already up to date.") {
+		t.Errorf("second merge should be a no-op:\n%s", out)
+	}
+
+	env.run("checkout", "feature")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("feature\n"), 0644)
+	env.run("commit", "-a", "-m", "diverge")
+	env.run("checkout", "-force", base)
+	if out, err := env.run("merge", "feature"); err != nil || !strings.Contains(out, "Fast-forward") {
+		t.Errorf("detached HEAD should fast-forward too: %v\n%s", err, out)
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("1"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "one")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("2"), 0644)
+	out, _ = env.run("commit", "-a", "-m", "two")
+	second := commitIDFromOutput(t, out)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(env.tmpDir)
+	if ok, err := isAncestor(first, second); err != nil || !ok {
+		t.Errorf("isAncestor(first, second) = %v, %v; want true", ok, err)
+	}
+	if ok, err := isAncestor(second, first); err != nil || ok {
+		t.Errorf("isAncestor(second, first) = %v, %v; want false", ok, err)
+	}
+}
+
+func TestMergeDiverged(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	write := func(name, content string) {
+		os.WriteFile(filepath.Join(env.tmpDir, name), []byte(content), 0644)
+	}
+	write("a.txt", "1\n2\n3\n4\n5\n")
+	write("c.txt", "same\n")
+	env.run("add", "a.txt", "c.txt")
+	env.run("commit", "-m", "base")
+	env.run("branch", "feature")
+	write("a.txt", "one\n2\n3\n4\n5\n")
+	env.run("commit", "-a", "-m", "main edits the top")
+	env.run("checkout", "feature")
+	write("a.txt", "1\n2\n3\n4\nfive\n")
+	write("b.txt", "new\n")
+	env.run("add", "b.txt")
+	out, _ := env.run("commit", "-a", "-m", "feature edits the bottom")
+	feature := commitIDFromOutput(t, out)
+	env.run("checkout", "main")
+
+	out, err := env.run("merge", "feature")
+	if err != nil || !strings.Contains(out, "Committed") {
+		t.Fatalf("merge failed: %v\n%s", err, out)
+	}
+	merge := commitIDFromOutput(t, out)
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, "a.txt")); string(data) != "one\n2\n3\n4\nfive\n" {
+		t.Errorf("a.txt should combine both edits, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, "b.txt")); err != nil {
+		t.Errorf("b.txt from feature should be merged in")
+	}
+	meta, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", merge, "meta.txt"))
+	if !strings.Contains(string(meta), "merge: "+feature+"\n") || !strings.Contains(string(meta), "Merge branch 'feature'") {
+		t.Errorf("merge commit should record feature as a parent:\n%s", meta)
+	}
+	if out, _ := env.run("log", "--oneline"); strings.Count(out, "\n") != 4 || !strings.Contains(out, "feature edits the bottom") {
+		t.Errorf("log should include both lines of history:\n%s", out)
+	}
+	out, err = env.run("commit", "--amend", "-m", "merged")
+	if err != nil {
+		t.Fatalf("amending the merge failed: %v\n%s", err, out)
+	}
+	meta, _ = os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", commitIDFromOutput(t, out), "meta.txt"))
+	if !strings.Contains(string(meta), "merge: "+feature+"\n") || !strings.Contains(string(meta), "merged") {
+		t.Errorf("amending a merge commit should keep its merge parent:\n%s", meta)
+	}
+
+	env.run("checkout", "feature")
+	write("c.txt", "feature\n")
+	env.run("commit", "-a", "-m", "feature changes c")
+	env.run("checkout", "main")
+	write("c.txt", "main\n")
+	env.run("commit", "-a", "-m", "main changes c")
+	out, err = env.run("merge", "feature")
+	if err == nil || !strings.Contains(out, "CONFLICT: merge conflict in c.txt") {
+		t.Fatalf("expected a conflict: %v\n%s", err, out)
+	}
+	want := "<<<<<<< HEAD\nmain\n=======\nfeature\n>>>>>>> feature\n"
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, "c.txt")); string(data) != want {
+		t.Errorf("unexpected conflict markers:\n%s", data)
+	}
+	write("c.txt", "resolved\n")
+	env.run("add", "c.txt")
+	out, err = env.run("commit", "-m", "resolve")
+	if err != nil {
+		t.Fatalf("commit after conflict failed: %v\n%s", err, out)
+	}
+	meta, _ = os.ReadFile(filepath.Join(env.tmpDir, ".fool", "objects", commitIDFromOutput(t, out), "meta.txt"))
+	if !strings.Contains(string(meta), "merge: ") {
+		t.Errorf("the commit concluding a merge should be a merge commit:\n%s", meta)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, ".fool", "MERGE_HEAD")); !os.IsNotExist(err) {
+		t.Errorf("MERGE_HEAD should be removed after the merge is committed")
+	}
+}
+
+func TestThreeWayMerge(t *testing.T) {
+	base := []byte("a\nb\nc\nd\ne\n")
+	tests := []struct {
+		ours, theirs, want string
+		conflict           bool
+	}{
+		{"A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", false},
+		{"a\nb\nc\nd\ne\n", "a\nb\nx\nd\ne\n", "a\nb\nx\nd\ne\n", false},
+		{"a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", false},
+		{"a\nb\nours\nd\ne\n", "a\nb\ntheirs\nd\ne\n",
+			"a\nb\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> feature\nd\ne\n", true},
+		{"a\nc\nd\ne\n", "a\nb\nc\nd\ne\nf\n", "a\nc\nd\ne\nf\n", false},
+	}
+	for i, tt := range tests {
+		// cmdMerge labels the other side with the branch or commit merged.
+		got, conflict := threeWayMerge(base, []byte(tt.ours), []byte(tt.theirs), "feature")
+		if string(got) != tt.want || conflict != tt.conflict {
+			t.Errorf("case %d: got %q (conflict %v), want %q (conflict %v)", i, got, conflict, tt.want, tt.conflict)
+		}
+	}
+}
+
+func TestDiffCommits(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "gone.txt"), []byte("gone\n"), 0644)
+	env.run("add", "a.txt", "gone.txt")
+	out, _ := env.run("commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("b\n"), 0644)
+	os.WriteFile(filepath.Join(env.tmpDir, "new.txt"), []byte("new\n"), 0644)
+	env.run("add", "a.txt", "new.txt")
+	env.run("rm", "gone.txt")
+	out, _ = env.run("commit", "-m", "second")
+	second := commitIDFromOutput(t, out)
+
+	out, err := env.run("diff", first, second)
+	if err != nil {
+		t.Fatalf("diff failed: %v\n%s", err, out)
+	}
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -1,1 +1,1 @@\n-a\n+b\n" +
+		"--- a/gone.txt\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-gone\n" +
+		"--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,1 @@\n+new\n"
+	if out != want {
+		t.Errorf("unexpected diff between commits:\n%s", out)
+	}
+	if out, _ := env.run("diff", first[:8], second[:8], "--", "a.txt"); !strings.HasPrefix(out, "--- a/a.txt") || strings.Contains(out, "new.txt") {
+		t.Errorf("diff should be limited to a.txt:\n%s", out)
+	}
+
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("c\n"), 0644)
+	out, _ = env.run("diff", first)
+	if !strings.Contains(out, "-a\n+c\n") || !strings.Contains(out, "--- a/gone.txt\n+++ /dev/null") {
+		t.Errorf("unexpected diff against the working directory:\n%s", out)
+	}
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(env.tmpDir)
+	if _, err := diffCommits(first, "nonexistent"); err == nil {
+		t.Errorf("diffCommits should reject an unknown commit")
+	}
+}
+
+func TestReflog(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("1"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("2"), 0644)
+	out, _ = env.run("commit", "-a", "-m", "second")
+	second := commitIDFromOutput(t, out)
+	env.run("reset", "--soft")
+	env.run("reset", "HEAD")
+	env.run("checkout", "--force", first)
+
+	out, err := env.run("reflog")
+	if err != nil {
+		t.Fatalf("reflog failed: %v\n%s", err, out)
+	}
+	want := first[:8] + " HEAD@{0}: checkout: moving from main to " + first + "\n" +
+		first[:8] + " HEAD@{1}: reset: moving to HEAD~1\n" +
+		second[:8] + " HEAD@{2}: commit: second\n" +
+		first[:8] + " HEAD@{3}: commit (initial): first\n"
+	if out != want {
+		t.Errorf("unexpected reflog:\n%s\nwant:\n%s", out, want)
+	}
+
+	// The lost commit can be recovered from the reflog.
+	env.run("checkout", second)
+	if out, err := env.run("branch", "recovery"); err != nil {
+		t.Fatalf("branch failed: %v\n%s", err, out)
+	}
+	ref, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "refs", "heads", "recovery"))
+	if strings.TrimSpace(string(ref)) != second {
+		t.Errorf("recovery should point to %s, got %q", second, ref)
+	}
+
+	path := filepath.Join(env.tmpDir, ".fool", "reflog")
+	data, _ := os.ReadFile(path)
+	old := fmt.Sprintf("%s %s %d commit: ancient\n", first, nullCommitID, time.Now().Add(-100*24*time.Hour).Unix())
+	os.WriteFile(path, append([]byte(old), data...), 0644)
+	if out, _ := env.run("reflog", "expire"); !strings.Contains(out, "Removed 1 reflog entries") {
+		t.Errorf("unexpected reflog expire output: %s", out)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "ancient") || strings.Count(string(data), "\n") != 5 {
+		t.Errorf("expire should drop only the old entry:\n%s", data)
+	}
+}
+
+func TestRemote(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	other := t.TempDir()
+	if out, err := env.run("remote", "add", "origin", other); err == nil || !strings.Contains(out, "not a fool repository") {
+		t.Errorf("adding a non-repository should fail: %v\n%s", err, out)
+	}
+	os.Mkdir(filepath.Join(other, ".fool"), 0755)
+	if out, err := env.run("remote", "add", "origin", other); err != nil {
+		t.Fatalf("remote add failed: %v\n%s", err, out)
+	}
+	env.run("remote", "add", "backup", other)
+	if out, err := env.run("remote", "add", "origin", other); err == nil || !strings.Contains(out, "already exists") {
+		t.Errorf("duplicate remote should fail: %v\n%s", err, out)
+	}
+	if out, _ := env.run("remote", "-v"); out != "backup\t"+other+"\norigin\t"+other+"\n" {
+		t.Errorf("unexpected remote -v output:\n%s", out)
+	}
+	data, _ := os.ReadFile(filepath.Join(env.tmpDir, ".fool", "config"))
+	if !strings.Contains(string(data), "[remote \"origin\"]\n\turl = "+other+"\n") {
+		t.Errorf("unexpected config:\n%s", data)
+	}
+	env.run("remote", "remove", "backup")
+	if out, _ := env.run("remote"); out != "origin\n" {
+		t.Errorf("unexpected remote list after remove:\n%s", out)
+	}
+	if out, err := env.run("remote", "remove", "backup"); err == nil || !strings.Contains(out, "no such remote") {
+		t.Errorf("removing a missing remote should fail: %v\n%s", err, out)
+	}
+}
+
+func TestPush(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	remote := t.TempDir()
+	env.run("init", remote)
+	env.run("remote", "add", "origin", remote)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("1"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("2"), 0644)
+	out, _ = env.run("commit", "-a", "-m", "second")
+	second := commitIDFromOutput(t, out)
+
+	out, err := env.run("push", "origin", "main")
+	if err != nil || !strings.Contains(out, "Pushed 2 commit(s)") {
+		t.Fatalf("push failed: %v\n%s", err, out)
+	}
+	ref, _ := os.ReadFile(filepath.Join(remote, ".fool", "refs", "heads", "main"))
+	if strings.TrimSpace(string(ref)) != second {
+		t.Errorf("remote main should point to %s, got %q", second, ref)
+	}
+	if _, err := os.Stat(filepath.Join(remote, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("push must not touch the remote's working directory")
+	}
+	if out, _ := env.run("-C", remote, "log", "--oneline"); out != second[:8]+" second\n"+first[:8]+" first\n" {
+		t.Errorf("unexpected remote log:\n%s", out)
+	}
+	if out, _ := env.run("push", "origin"); !strings.Contains(out, "Everything up-to-date") {
+		t.Errorf("second push should be a no-op:\n%s", out)
+	}
+
+	env.run("reset", "--soft")
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("3"), 0644)
+	out, _ = env.run("commit", "-a", "-m", "rewritten")
+	rewritten := commitIDFromOutput(t, out)
+	if out, err := env.run("push", "origin", "main"); err == nil || !strings.Contains(out, "non-fast-forward") {
+		t.Errorf("non-fast-forward push should be rejected: %v\n%s", err, out)
+	}
+	if out, err := env.run("push", "--force", "origin", "main"); err != nil {
+		t.Fatalf("push --force failed: %v\n%s", err, out)
+	}
+	ref, _ = os.ReadFile(filepath.Join(remote, ".fool", "refs", "heads", "main"))
+	if strings.TrimSpace(string(ref)) != rewritten {
+		t.Errorf("forced push should move remote main to %s, got %q", rewritten, ref)
+	}
+}
+
+func TestFetchAndPull(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	remote := t.TempDir()
+	env.run("init", remote)
+	os.WriteFile(filepath.Join(remote, "a.txt"), []byte("1\n"), 0644)
+	env.run("-C", remote, "add", "a.txt")
+	out, _ := env.run("-C", remote, "commit", "-m", "first")
+	first := commitIDFromOutput(t, out)
+	env.run("remote", "add", "origin", remote)
+
+	out, err := env.run("fetch", "origin")
+	if err != nil || !strings.Contains(out, "Fetched 1 commit(s)") || !strings.Contains(out, "main -> origin/main") {
+		t.Fatalf("fetch failed: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(env.tmpDir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("fetch must not touch the working directory")
+	}
+	if out, _ := env.run("log"); !strings.Contains(out, "No commits yet.") {
+		t.Errorf("fetch must not move HEAD:\n%s", out)
+	}
+
+	out, err = env.run("pull", "origin", "main")
+	if err != nil || !strings.Contains(out, "Fast-forward") {
+		t.Fatalf("pull failed: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(env.tmpDir, "a.txt")); string(data) != "1\n" {
+		t.Errorf("pull should check out a.txt, got %q", data)
+	}
+	if out, _ := env.run("log", "--oneline"); out != first[:8]+" first\n" {
+		t.Errorf("unexpected log after pull:\n%s", out)
+	}
+
+	os.WriteFile(filepath.Join(remote, "a.txt"), []byte("2\n"), 0644)
+	env.run("-C", remote, "commit", "-a", "-m", "remote work")
+	os.WriteFile(filepath.Join(env.tmpDir, "b.txt"), []byte("b\n"), 0644)
+	env.run("add", "b.txt")
+	env.run("commit", "-m", "local work")
+	out, err = env.run("pull", "origin", "main")
+	if err == nil || !strings.Contains(out, "Cannot fast-forward; please merge manually") {
+		t.Errorf("diverged pull should stop: %v\n%s", err, out)
+	}
+	if out, err := env.run("merge", "origin/main"); err != nil || !strings.Contains(out, "Committed") {
+		t.Errorf("the fetched branch should be mergeable by hand: %v\n%s", err, out)
+	}
+}
+
+func TestClone(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	src := filepath.Join(env.tmpDir, "src")
+	env.run("init", src)
+	os.MkdirAll(filepath.Join(src, "dir"), 0755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("committed\n"), 0644)
+	os.WriteFile(filepath.Join(src, "dir", "b.txt"), []byte("b\n"), 0644)
+	env.run("-C", src, "add", "a.txt", "dir/b.txt")
+	out, _ := env.run("-C", src, "commit", "-m", "first")
+	id := commitIDFromOutput(t, out)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("dirty\n"), 0644)
+	os.WriteFile(filepath.Join(src, "untracked.txt"), []byte("x"), 0644)
+
+	out, err := env.run("clone", "src", "dst")
+	if err != nil {
+		t.Fatalf("clone failed: %v\n%s", err, out)
+	}
+	dst := filepath.Join(env.tmpDir, "dst")
+	if data, _ := os.ReadFile(filepath.Join(dst, "a.txt")); string(data) != "committed\n" {
+		t.Errorf("a.txt should come from the commit, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "dir", "b.txt")); string(data) != "b\n" {
+		t.Errorf("dir/b.txt should be checked out, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "untracked.txt")); !os.IsNotExist(err) {
+		t.Errorf("untracked files must not be cloned")
+	}
+	if out, _ := env.run("-C", dst, "log", "--oneline"); out != id[:8]+" first\n" {
+		t.Errorf("unexpected log in the clone:\n%s", out)
+	}
+	srcAbs, _ := filepath.Abs(src)
+	if out, _ := env.run("-C", dst, "remote", "-v"); out != "origin\t"+srcAbs+"\n" {
+		t.Errorf("clone should add origin:\n%s", out)
+	}
+	if out, _ := env.run("-C", dst, "status", "--short"); strings.Contains(out, "a.txt") {
+		t.Errorf("the clone should be clean:\n%s", out)
+	}
+	if out, err := env.run("clone", "src", "dst"); err == nil || !strings.Contains(out, "not empty") {
+		t.Errorf("cloning into a non-empty directory should fail: %v\n%s", err, out)
+	}
+}
+
+func TestServe(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("hello\n"), 0644)
+	env.run("add", "a.txt")
+	out, _ := env.run("commit", "-m", "first")
+	id := commitIDFromOutput(t, out)
+	env.run("tag", "v1")
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(env.tmpDir)
+	srv := httptest.NewServer(newServeHandler())
+	defer srv.Close()
+	get := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/info/refs"); code != 200 || body != id+"\tHEAD\n"+id+"\trefs/heads/main\n"+id+"\trefs/tags/v1\n" {
+		t.Errorf("unexpected /info/refs (%d):\n%s", code, body)
+	}
+	if code, body := get("/objects/" + id + "/meta.txt"); code != 200 || !strings.Contains(body, "commit: "+id) {
+		t.Errorf("unexpected meta.txt (%d):\n%s", code, body)
+	}
+	if code, body := get("/objects/" + id + "/a.txt"); code != 200 || body != "hello\n" {
+		t.Errorf("unexpected object file (%d): %q", code, body)
+	}
+	if code, body := get("/log"); code != 200 || !strings.Contains(body, "commit "+id) {
+		t.Errorf("unexpected /log (%d):\n%s", code, body)
+	}
+	code, body := get("/api/commits")
+	var commits []commitJSON
+	if err := json.Unmarshal([]byte(body), &commits); code != 200 || err != nil || len(commits) != 1 || commits[0].ID != id || commits[0].Message != "first" {
+		t.Errorf("unexpected /api/commits (%d, %v):\n%s", code, err, body)
+	}
+	for _, path := range []string{"/objects/" + id + "/../../config", "/objects/..%2f..%2fconfig/x", "/objects/" + id + "/missing.txt"} {
+		if code, _ := get(path); code != 404 {
+			t.Errorf("GET %s = %d, want 404", path, code)
+		}
+	}
+	resp, err := http.Post(srv.URL+"/log", "text/plain", strings.NewReader("x"))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("POST /log = %d, want 405", resp.StatusCode)
+		}
+	}
+}
+
+func TestColor(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	if _, err := env.run("init"); err != nil {
+		t.Fatalf("init failed")
+	}
+	os.WriteFile(filepath.Join(env.tmpDir, "a.txt"), []byte("a\n"), 0644)
+	env.run("add", "a.txt")
+	env.run("commit", "-m", "first")
+	// Output to a pipe is never colored.
+	if out, _ := env.run("log", "--oneline"); strings.Contains(out, "\033[") {
+		t.Errorf("log output to a pipe should not be colored: %q", out)
+	}
+	if out, err := env.run("-no-color", "status"); err != nil || !strings.Contains(out, "On branch main") {
+		t.Errorf("-no-color status failed: %v\n%s", err, out)
+	}
+
+	defer func(saved bool) { useColor = saved }(useColor)
+	useColor = true
+	patch := "--- a/a.txt\n+++ b/a.txt\n@@ -1,1 +1,1 @@\n-a\n+b\n"
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -1,1 +1,1 @@\n" + colorRed + "-a" + colorReset + "\n" + colorGreen + "+b" + colorReset + "\n"
+	if got := colorDiff(patch); got != want {
+		t.Errorf("colorDiff = %q, want %q", got, want)
+	}
+	entry := "commit abc\nDate: 2024-01-01\nMessage: x"
+	if got := colorLogDate(entry); got != "commit abc\nDate: "+colorDim+"2024-01-01"+colorReset+"\nMessage: x" {
+		t.Errorf("unexpected colorLogDate output: %q", got)
+	}
+	useColor = false
+	if got := colorDiff(patch); got != patch {
+		t.Errorf("colorDiff should not change the patch with color off: %q", got)
+	}
+}
+
+func TestFetchAfterAmend(t *testing.T) {
+	env := setupFoolTestEnv(t)
+	defer os.RemoveAll(env.tmpDir)
+	src := filepath.Join(env.tmpDir, "src")
+	env.run("init", src)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("1\n"), 0644)
+	env.run("-C", src, "add", "a.txt")
+	env.run("-C", src, "commit", "-m", "c1")
+	if out, err := env.run("clone", "src", "dst"); err != nil {
+		t.Fatalf("clone failed: %v\n%s", err, out)
+	}
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("2\n"), 0644)
+	out, _ := env.run("-C", src, "commit", "-a", "-m", "c2")
+	c2 := commitIDFromOutput(t, out)
+	env.run("-C", src, "branch", "feature")
+	out, _ = env.run("-C", src, "commit", "--amend", "-m", "c2 amended")
+	amended := commitIDFromOutput(t, out)
+	// reset --soft likewise drops a commit that a branch still names.
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("3\n"), 0644)
+	out, _ = env.run("-C", src, "commit", "-a", "-m", "c3")
+	c3 := commitIDFromOutput(t, out)
+	env.run("-C", src, "branch", "topic")
+	env.run("-C", src, "reset", "--soft", "HEAD~1")
+
+	out, err := env.run("-C", "dst", "fetch", "origin")
+	if err != nil {
+		t.Fatalf("fetch failed: %v\n%s", err, out)
+	}
+	dst := filepath.Join(env.tmpDir, "dst")
+	for ref, want := range map[string]string{"feature": c2, "topic": c3, "main": amended} {
+		data, _ := os.ReadFile(filepath.Join(dst, ".fool", "refs", "remotes", "origin", ref))
+		if strings.TrimSpace(string(data)) != want {
+			t.Errorf("origin/%s = %q, want %s", ref, data, want)
+		}
+		if _, err := os.Stat(filepath.Join(dst, ".fool", "objects", want, "meta.txt")); err != nil {
+			t.Errorf("commit of origin/%s was not fetched", ref)
+		}
+	}
+	if out, _ := env.run("-C", "dst", "show", "origin/feature"); !strings.Contains(out, "c2") {
+		t.Errorf("origin/feature should be readable after fetch:\n%s", out)
+	}
+}
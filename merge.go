@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// mergeHeadPath is where a merge that stopped on conflicts records the
+// commit being merged, for the commit that concludes it.
+func mergeHeadPath() string {
+	return filepath.Join(".fool", "MERGE_HEAD")
+}
+
+// isAncestor reports whether ancestorID is descendantID or is reached from
+// it by following parent links.
+func isAncestor(ancestorID, descendantID string) (bool, error) {
+	seen := map[string]bool{}
+	var walk func(id string) (bool, error)
+	walk = func(id string) (bool, error) {
+		if id == "" || seen[id] {
+			return false, nil
+		}
+		seen[id] = true
+		if id == ancestorID {
+			return true, nil
+		}
+		c, err := loadCommit(id)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range c.parents() {
+			if found, err := walk(p); found || err != nil {
+				return found, err
+			}
+		}
+		return false, nil
+	}
+	if ancestorID == "" {
+		return false, nil
+	}
+	return walk(descendantID)
+}
+
+// mergeBase finds the common ancestor of a and b closest to b by collecting
+// everything reachable from a and walking b's parents breadth first until
+// the two meet. It returns "" for unrelated histories.
+func mergeBase(a, b string) string {
+	fromA := map[string]bool{}
+	for _, c := range commitHistory(a) {
+		fromA[c.ID] = true
+	}
+	queue := []string{b}
+	seen := map[string]bool{b: true}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if fromA[id] {
+			return id
+		}
+		c, err := loadCommit(id)
+		if err != nil {
+			continue
+		}
+		for _, p := range c.parents() {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	return ""
+}
+
+// textChange is one edit a side made to the base: the base lines
+// [start, end) are replaced by lines.
+type textChange struct {
+	start, end int
+	lines      []string
+}
+
+// textChanges turns an edit script against base into the changes it makes.
+func textChanges(ops []diffOp) []textChange {
+	var changes []textChange
+	var cur *textChange
+	at := 0
+	for _, op := range ops {
+		if op.Kind == ' ' {
+			if cur != nil {
+				changes = append(changes, *cur)
+				cur = nil
+			}
+			at++
+			continue
+		}
+		if cur == nil {
+			cur = &textChange{start: at, end: at}
+		}
+		if op.Kind == '-' {
+			at++
+			cur.end = at
+		} else {
+			cur.lines = append(cur.lines, op.Line)
+		}
+	}
+	if cur != nil {
+		changes = append(changes, *cur)
+	}
+	return changes
+}
+
+// applyChanges returns base[start:end] with changes, which must lie within
+// that range, applied.
+func applyChanges(base []string, start, end int, changes []textChange) []string {
+	var out []string
+	at := start
+	for _, c := range changes {
+		out = append(out, base[at:c.start]...)
+		out = append(out, c.lines...)
+		at = c.end
+	}
+	return append(out, base[at:end]...)
+}
+
+// threeWayMerge combines the changes ours and theirs made to base. Changes to
+// separate parts of the file are both kept; where the two sides changed the
+// same or adjacent lines differently, both versions are kept between
+// <<<<<<< HEAD, ======= and >>>>>>> label markers and the result reports a
+// conflict. Like the diffs it is built on, it works on whole lines.
+func threeWayMerge(base, ours, theirs []byte, label string) ([]byte, bool) {
+	baseLines := splitContentLines(base)
+	sides := [2][]textChange{
+		textChanges(diffLines(baseLines, splitContentLines(ours))),
+		textChanges(diffLines(baseLines, splitContentLines(theirs))),
+	}
+	var out []string
+	conflict := false
+	at := 0
+	next := [2]int{}
+	for next[0] < len(sides[0]) || next[1] < len(sides[1]) {
+		// Start a region at the earliest pending change, then grow it while
+		// a change from either side starts inside or right after it.
+		first := 0
+		if next[0] == len(sides[0]) || (next[1] < len(sides[1]) && sides[1][next[1]].start < sides[0][next[0]].start) {
+			first = 1
+		}
+		start, end := sides[first][next[first]].start, sides[first][next[first]].end
+		var region [2][]textChange
+		for grew := true; grew; {
+			grew = false
+			for s := range sides {
+				for next[s] < len(sides[s]) && sides[s][next[s]].start <= end {
+					c := sides[s][next[s]]
+					region[s] = append(region[s], c)
+					end = max(end, c.end)
+					next[s]++
+					grew = true
+				}
+			}
+		}
+		out = append(out, baseLines[at:start]...)
+		oursLines := applyChanges(baseLines, start, end, region[0])
+		theirsLines := applyChanges(baseLines, start, end, region[1])
+		switch {
+		case len(region[1]) == 0:
+			out = append(out, oursLines...)
+		case len(region[0]) == 0, slices.Equal(oursLines, theirsLines):
+			out = append(out, theirsLines...)
+		default:
+			conflict = true
+			out = append(out, "<<<<<<< HEAD")
+			out = append(out, oursLines...)
+			out = append(out, "=======")
+			out = append(out, theirsLines...)
+			out = append(out, ">>>>>>> "+label)
+		}
+		at = end
+	}
+	out = append(out, baseLines[at:]...)
+	if len(out) == 0 {
+		return nil, conflict
+	}
+	return []byte(strings.Join(out, "\n") + "\n"), conflict
+}
+
+// mergeSnapshots works out the merge of commit theirs into commit ours
+// relative to their common ancestor base. Files only one side changed take
+// that side's version. Conflicted text files get conflict markers in
+// results; other conflicts keep whichever version still exists.
+func mergeSnapshots(base, ours, theirs, label string) changePlan {
+	plan := changePlan{results: map[string][]byte{}}
+	var paths []string
+	for _, id := range []string{base, ours, theirs} {
+		for _, f := range snapshotFiles(id) {
+			if !containsString(paths, f) {
+				paths = append(paths, f)
+			}
+		}
+	}
+	read := func(id, f string) ([]byte, bool) {
+		if id == "" {
+			return nil, false
+		}
+		data, err := os.ReadFile(filepath.Join(".fool", "objects", id, f))
+		return data, err == nil
+	}
+	for _, f := range paths {
+		b, inBase := read(base, f)
+		o, inOurs := read(ours, f)
+		t, inTheirs := read(theirs, f)
+		switch {
+		case inOurs == inTheirs && bytes.Equal(o, t), inTheirs == inBase && bytes.Equal(t, b):
+			// Nothing to take from theirs.
+		case inOurs == inBase && bytes.Equal(o, b):
+			if inTheirs {
+				plan.results[f] = t
+			} else {
+				plan.removed = append(plan.removed, f)
+			}
+		case inOurs && inTheirs && !isBinary(b) && !isBinary(o) && !isBinary(t):
+			merged, conflict := threeWayMerge(b, o, t, label)
+			plan.results[f] = merged
+			if conflict {
+				plan.conflicts = append(plan.conflicts, f)
+			}
+		default:
+			if !inOurs {
+				plan.results[f] = t
+			}
+			plan.conflicts = append(plan.conflicts, f)
+		}
+	}
+	return plan
+}
+
+func cmdMerge(args []string) {
+	ensureRepo()
+	if len(args) != 1 {
+		fmt.Println("Usage: fool merge <branch|commitID>")
+		return
+	}
+	if _, err := os.Stat(mergeHeadPath()); err == nil {
+		fmt.Println("Error: a merge is already in progress; commit the result first.")
+		os.Exit(1)
+	}
+	target, err := resolveRef(args[0])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	ensureCleanTree("merge")
+	head := headCommitID()
+	if upToDate, err := isAncestor(target, head); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	} else if upToDate {
+		fmt.Println("Already up to date.")
+		return
+	}
+	fastForward := head == ""
+	if !fastForward {
+		if fastForward, err = isAncestor(head, target); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if fastForward {
+		if _, _, err := restoreSnapshot(head, target); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if err := updateHEAD(target); err != nil {
+			fmt.Println("Error updating HEAD:", err)
+			os.Exit(1)
+		}
+		appendReflog(head, target, "merge "+args[0], "Fast-forward")
+		fmt.Printf("Updating %s..%s\nFast-forward\n", abbrevID(head, defaultAbbrev), abbrevID(target, defaultAbbrev))
+		if stats := commitStat(head, target); len(stats) > 0 {
+			fmt.Print(formatStat(stats))
+		}
+		return
+	}
+
+	plan := mergeSnapshots(mergeBase(head, target), head, target, args[0])
+	// Conflicted files are written with their markers but left unstaged
+	// until they have been resolved and added.
+	clean := changePlan{results: map[string][]byte{}, removed: plan.removed}
+	for f, data := range plan.results {
+		if containsString(plan.conflicts, f) {
+			if err := os.MkdirAll(filepath.Dir(f), 0755); err == nil {
+				err = os.WriteFile(f, data, 0644)
+			}
+			if err != nil {
+				fmt.Printf("Error writing '%s': %v\n", f, err)
+				os.Exit(1)
+			}
+			continue
+		}
+		clean.results[f] = data
+	}
+	applyPlan(clean)
+	if err := os.WriteFile(mergeHeadPath(), []byte(target+"\n"), 0644); err != nil {
+		fmt.Println("Error recording the merge:", err)
+		os.Exit(1)
+	}
+	if len(plan.conflicts) > 0 {
+		for _, f := range plan.conflicts {
+			fmt.Printf("CONFLICT: merge conflict in %s\n", f)
+		}
+		fmt.Println("Automatic merge failed; fix the conflicts, 'fool add' the files and commit the result.")
+		os.Exit(1)
+	}
+	kind := "commit"
+	if _, ok := branchExists(args[0]); ok {
+		kind = "branch"
+	}
+	cmdCommit([]string{"-m", fmt.Sprintf("Merge %s '%s'", kind, args[0])})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nullCommitID stands in the reflog for "no commit", as before the first
+// commit of a branch.
+const nullCommitID = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// reflogExpiry is how long reflog expire keeps entries.
+const reflogExpiry = 90 * 24 * time.Hour
+
+// reflogDisplayCount is how many entries fool reflog shows.
+const reflogDisplayCount = 20
+
+func reflogPath() string {
+	return filepath.Join(".fool", "reflog")
+}
+
+// reflogEntry is one line of .fool/reflog:
+// "<newID> <oldID> <unix time> <action>: <description>".
+type reflogEntry struct {
+	New, Old string
+	Time     time.Time
+	Message  string // "<action>: <description>"
+}
+
+// appendReflog records that HEAD moved from oldID to newID. Failing to write
+// the reflog never stops the command that moved HEAD.
+func appendReflog(oldID, newID, action, description string) {
+	if oldID == "" {
+		oldID = nullCommitID
+	}
+	if newID == "" {
+		newID = nullCommitID
+	}
+	f, err := os.OpenFile(reflogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println("Warning: could not update the reflog:", err)
+		return
+	}
+	defer f.Close()
+	description = strings.ReplaceAll(description, "\n", " ")
+	fmt.Fprintf(f, "%s %s %d %s: %s\n", newID, oldID, time.Now().Unix(), action, description)
+}
+
+// readReflog returns the reflog entries, oldest first, skipping lines it
+// cannot parse.
+func readReflog() []reflogEntry {
+	data, err := os.ReadFile(reflogPath())
+	if err != nil {
+		return nil
+	}
+	var entries []reflogEntry
+	for _, line := range splitLines(string(data)) {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		sec, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, reflogEntry{fields[0], fields[1], time.Unix(sec, 0), fields[3]})
+	}
+	return entries
+}
+
+func cmdReflog(args []string) {
+	ensureRepo()
+	if len(args) > 0 && args[0] == "expire" {
+		if len(args) != 1 {
+			fmt.Println("Usage: fool reflog expire")
+			os.Exit(1)
+		}
+		reflogExpire()
+		return
+	}
+	if len(args) > 0 {
+		fmt.Println("Usage: fool reflog [expire]")
+		os.Exit(1)
+	}
+	entries := readReflog()
+	for n := 0; n < reflogDisplayCount && n < len(entries); n++ {
+		e := entries[len(entries)-1-n]
+		fmt.Printf("%s HEAD@{%d}: %s\n", abbrevID(e.New, defaultAbbrev), n, e.Message)
+	}
+}
+
+// reflogExpire drops the entries older than reflogExpiry.
+func reflogExpire() {
+	entries := readReflog()
+	cutoff := time.Now().Add(-reflogExpiry)
+	var kept strings.Builder
+	removed := 0
+	for _, e := range entries {
+		if e.Time.Before(cutoff) {
+			removed++
+			continue
+		}
+		fmt.Fprintf(&kept, "%s %s %d %s\n", e.New, e.Old, e.Time.Unix(), e.Message)
+	}
+	if err := writeFileAtomic(reflogPath(), []byte(kept.String())); err != nil {
+		fmt.Println("Error writing reflog:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Removed %d reflog entries older than %d days.\n", removed, int(reflogExpiry.Hours()/24))
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// detachedHEAD returns the commit ID stored in .fool/HEAD when HEAD is
+// detached, or "" if HEAD names a branch.
+func detachedHEAD() string {
+	data, err := os.ReadFile(filepath.Join(".fool", "HEAD"))
+	if err != nil {
+		return ""
+	}
+	head := strings.TrimSpace(string(data))
+	if strings.HasPrefix(head, "ref: ") {
+		return ""
+	}
+	return head
+}
+
+// currentBranch returns the branch named by a "ref: refs/heads/<branch>"
+// HEAD, "main" if there is no HEAD file, or "" if HEAD is detached.
+func currentBranch() string {
+	data, err := os.ReadFile(filepath.Join(".fool", "HEAD"))
+	if err != nil {
+		return "main"
+	}
+	head := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(head, "ref: ") {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(head, "ref: "), "refs/heads/")
+}
+
+func branchRefPath(name string) string {
+	return filepath.Join(".fool", "refs", "heads", filepath.FromSlash(name))
+}
+
+func tagRefPath(name string) string {
+	return filepath.Join(".fool", "refs", "tags", filepath.FromSlash(name))
+}
+
+// readBranch returns the commit a branch points to, or "" if it has no ref.
+func readBranch(name string) string {
+	data, err := os.ReadFile(branchRefPath(name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// branchExists reports whether name is a branch, returning the commit it
+// points to. The checked-out branch counts even before its ref is written.
+func branchExists(name string) (string, bool) {
+	if _, err := os.Stat(branchRefPath(name)); err == nil {
+		return readBranch(name), true
+	}
+	if name != "" && name == currentBranch() {
+		return headCommitID(), true
+	}
+	return "", false
+}
+
+// resolveRef turns a branch name, tag name, remote-tracking branch such as
+// "origin/main", "HEAD" or a full or abbreviated commit ID into a commit ID.
+// Branches win over tags, and both win over commit IDs that look the same.
+func resolveRef(name string) (string, error) {
+	if name == "HEAD" {
+		return resolveHEAD()
+	}
+	if id, ok := branchExists(name); ok {
+		if id == "" {
+			return "", fmt.Errorf("branch '%s' has no commits yet", name)
+		}
+		return id, nil
+	}
+	if data, err := os.ReadFile(tagRefPath(name)); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if remote, branch, ok := strings.Cut(name, "/"); ok {
+		if data, err := os.ReadFile(remoteTrackingRefPath(remote, branch)); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	id, err := resolveCommitPrefix(name)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not a branch or commit: %v", name, err)
+	}
+	return id, nil
+}
+
+// headCommitID returns the commit HEAD points to, or "" if there is none
+// yet.
+func headCommitID() string {
+	id, _ := resolveHEAD()
+	return id
+}
+
+// maxSymrefDepth bounds how many "ref: " pointers resolveHEAD follows, so a
+// cycle of symbolic refs cannot loop forever.
+const maxSymrefDepth = 5
+
+// resolveHEAD follows .fool/HEAD, and any "ref: <path>" pointers it leads
+// to, to the commit ID they end at. A repository without a HEAD file is on
+// main. Repositories that predate branch refs have no .fool/refs/heads yet,
+// so the latest logged commit stands in for their branch.
+func resolveHEAD() (string, error) {
+	target := "ref: refs/heads/main"
+	if data, err := os.ReadFile(filepath.Join(".fool", "HEAD")); err == nil {
+		target = strings.TrimSpace(string(data))
+	}
+	for depth := 0; strings.HasPrefix(target, "ref: "); depth++ {
+		if depth == maxSymrefDepth {
+			return "", errors.New("too many levels of symbolic refs in HEAD")
+		}
+		ref := strings.TrimPrefix(target, "ref: ")
+		data, err := os.ReadFile(filepath.Join(".fool", filepath.FromSlash(ref)))
+		if err != nil {
+			if _, err := os.Stat(filepath.Join(".fool", "refs", "heads")); os.IsNotExist(err) && depth == 0 {
+				if id := latestCommitID(); id != "" {
+					return id, nil
+				}
+			}
+			return "", errors.New("HEAD does not point to a commit yet")
+		}
+		target = strings.TrimSpace(string(data))
+	}
+	if target == "" {
+		return "", errors.New("HEAD does not point to a commit yet")
+	}
+	return target, nil
+}
+
+// updateHEAD moves the current branch (or a detached HEAD) to commitID. An
+// empty commitID leaves the branch without any commits.
+func updateHEAD(commitID string) error {
+	if detachedHEAD() != "" {
+		return writeFileAtomic(filepath.Join(".fool", "HEAD"), []byte(commitID+"\n"))
+	}
+	return writeBranch(currentBranch(), commitID)
+}
+
+// writeFileAtomic replaces path with data by renaming a temporary file over
+// it, so readers see either the old or the new content, never a partial one.
+// The temporary name starts with a dot, which no ref name may.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func writeBranch(name, commitID string) error {
+	path := branchRefPath(name)
+	if commitID == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(commitID+"\n"))
+}
+
+// listRefs returns the sorted names of the refs under .fool/refs/<kind>,
+// where kind is "heads" or "tags".
+func listRefs(kind string) []string {
+	root := filepath.Join(".fool", "refs", kind)
+	var names []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(names)
+	return names
+}
+
+// validateRefName rejects branch and tag names that would be ambiguous on
+// the command line or unsafe as a path under .fool/refs.
+func validateRefName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("name must not be empty")
+	case strings.HasPrefix(name, "-"):
+		return fmt.Errorf("name '%s' must not start with '-'", name)
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("name '%s' must not contain '..'", name)
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.Contains(name, "//"):
+		return fmt.Errorf("name '%s' has an empty path component", name)
+	case strings.HasSuffix(name, ".lock") || strings.HasPrefix(name, ".") || strings.Contains(name, "/."):
+		return fmt.Errorf("name '%s' is not allowed", name)
+	case name == "HEAD":
+		return errors.New("'HEAD' is not a valid name")
+	}
+	for _, r := range name {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune(`~^:?*[\`, r) {
+			return fmt.Errorf("name '%s' contains an invalid character %q", name, r)
+		}
+	}
+	return nil
+}
+
+// validateBranchName checks a new branch name. Beyond the rules shared with
+// tags, a branch "a/b" cannot coexist with a branch "a": under
+// .fool/refs/heads one needs a file where the other needs a directory.
+func validateBranchName(name string) error {
+	if err := validateRefName(name); err != nil {
+		return err
+	}
+	for _, b := range listRefs("heads") {
+		if strings.HasPrefix(name, b+"/") || strings.HasPrefix(b, name+"/") {
+			return fmt.Errorf("name '%s' conflicts with the existing branch '%s'", name, b)
+		}
+	}
+	return nil
+}
+
+func cmdBranch(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("branch", flag.ExitOnError)
+	del := fs.String("d", "", "delete the named branch")
+	fs.Parse(args)
+	current := currentBranch()
+	if *del != "" {
+		if *del == current {
+			fmt.Printf("Error: cannot delete branch '%s' while it is checked out.\n", *del)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(branchRefPath(*del)); err != nil {
+			fmt.Printf("Error: branch '%s' not found.\n", *del)
+			os.Exit(1)
+		}
+		id := readBranch(*del)
+		if err := os.Remove(branchRefPath(*del)); err != nil {
+			fmt.Println("Error deleting branch:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted branch %s (was %s).\n", *del, id)
+		return
+	}
+	if fs.NArg() == 0 {
+		branches := listRefs("heads")
+		if current != "" && !containsString(branches, current) {
+			branches = append(branches, current)
+			sort.Strings(branches)
+		}
+		if id := detachedHEAD(); id != "" {
+			fmt.Printf("* (HEAD detached at %s)\n", id)
+		}
+		for _, b := range branches {
+			if b == current {
+				fmt.Printf("* %s\n", b)
+			} else {
+				fmt.Printf("  %s\n", b)
+			}
+		}
+		return
+	}
+	name := fs.Arg(0)
+	if err := validateBranchName(name); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(branchRefPath(name)); err == nil || name == current {
+		fmt.Printf("Error: a branch named '%s' already exists.\n", name)
+		os.Exit(1)
+	}
+	head := headCommitID()
+	if head == "" {
+		fmt.Println("Error: cannot create a branch before the first commit.")
+		os.Exit(1)
+	}
+	// Pin the current branch to its commit before anything else can move
+	// the tip of the log.
+	if current != "" && readBranch(current) == "" {
+		if err := writeBranch(current, head); err != nil {
+			fmt.Println("Error creating branch:", err)
+			os.Exit(1)
+		}
+	}
+	if err := writeBranch(name, head); err != nil {
+		fmt.Println("Error creating branch:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created branch %s at %s\n", name, head)
+}
+
+// tagsByCommit maps each tagged commit ID to its tag names.
+func tagsByCommit() map[string][]string {
+	tags := map[string][]string{}
+	for _, name := range listRefs("tags") {
+		if data, err := os.ReadFile(tagRefPath(name)); err == nil {
+			id := strings.TrimSpace(string(data))
+			tags[id] = append(tags[id], name)
+		}
+	}
+	return tags
+}
+
+// decoration renders tag names the way log shows them, as in
+// " (tag: v1.0, tag: v1.0.1)", or "" if there are none.
+func decoration(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, t := range tags {
+		parts = append(parts, "tag: "+t)
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+func cmdTag(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("tag", flag.ExitOnError)
+	list := fs.Bool("l", false, "list tags")
+	del := fs.String("d", "", "delete the named tag")
+	var force bool
+	fs.BoolVar(&force, "f", false, "replace an existing tag")
+	fs.BoolVar(&force, "force", false, "replace an existing tag")
+	fs.Parse(args)
+	if *del != "" {
+		data, err := os.ReadFile(tagRefPath(*del))
+		if err != nil {
+			fmt.Printf("Error: tag '%s' not found.\n", *del)
+			os.Exit(1)
+		}
+		if err := os.Remove(tagRefPath(*del)); err != nil {
+			fmt.Println("Error deleting tag:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted tag '%s' (was %s)\n", *del, strings.TrimSpace(string(data)))
+		return
+	}
+	if *list || fs.NArg() == 0 {
+		for _, name := range listRefs("tags") {
+			fmt.Println(name)
+		}
+		return
+	}
+	if fs.NArg() > 2 {
+		fmt.Println("Usage: fool tag [-f] <name> [commitID]")
+		os.Exit(1)
+	}
+	name := fs.Arg(0)
+	if err := validateRefName(name); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	target := headCommitID()
+	if fs.NArg() == 2 {
+		var err error
+		if target, err = resolveRef(fs.Arg(1)); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	} else if target == "" {
+		fmt.Println("Error: cannot tag before the first commit.")
+		os.Exit(1)
+	}
+	if _, err := os.Stat(tagRefPath(name)); err == nil && !force {
+		fmt.Printf("Error: tag '%s' already exists. Use --force to replace it.\n", name)
+		os.Exit(1)
+	}
+	path := tagRefPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Println("Error creating tag:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(path, []byte(target+"\n"), 0644); err != nil {
+		fmt.Println("Error creating tag:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Tagged %s as '%s'\n", target, name)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// remoteNames returns the sorted names of the remotes in config.
+func remoteNames(config map[string]string) []string {
+	var names []string
+	for key := range config {
+		if rest, ok := strings.CutPrefix(key, "remote."); ok && strings.HasSuffix(rest, ".url") {
+			names = append(names, strings.TrimSuffix(rest, ".url"))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateRemoteURL checks that url is a local directory holding a fool
+// repository.
+func validateRemoteURL(url string) error {
+	info, err := os.Stat(filepath.Join(url, ".fool"))
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("'%s' is not a fool repository", url)
+	}
+	return nil
+}
+
+func cmdRemote(args []string) {
+	ensureRepo()
+	config := loadConfig()
+	if len(args) == 0 || args[0] == "-v" || args[0] == "--verbose" {
+		verbose := len(args) > 0
+		for _, name := range remoteNames(config) {
+			if verbose {
+				fmt.Printf("%s\t%s\n", name, config["remote."+name+".url"])
+			} else {
+				fmt.Println(name)
+			}
+		}
+		return
+	}
+	switch args[0] {
+	case "add":
+		if len(args) != 3 {
+			fmt.Println("Usage: fool remote add <name> <path>")
+			os.Exit(1)
+		}
+		name, url := args[1], args[2]
+		if err := validateRefName(name); err != nil {
+			fmt.Println("Error: invalid remote name:", err)
+			os.Exit(1)
+		}
+		if _, ok := config["remote."+name+".url"]; ok {
+			fmt.Printf("Error: remote '%s' already exists.\n", name)
+			os.Exit(1)
+		}
+		if err := validateRemoteURL(url); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		config["remote."+name+".url"] = url
+		if err := saveConfig(config); err != nil {
+			fmt.Println("Error writing config:", err)
+			os.Exit(1)
+		}
+	case "remove", "rm":
+		if len(args) != 2 {
+			fmt.Println("Usage: fool remote remove <name>")
+			os.Exit(1)
+		}
+		name := args[1]
+		if _, ok := config["remote."+name+".url"]; !ok {
+			fmt.Printf("Error: no such remote '%s'.\n", name)
+			os.Exit(1)
+		}
+		for key := range config {
+			if strings.HasPrefix(key, "remote."+name+".") {
+				delete(config, key)
+			}
+		}
+		if err := saveConfig(config); err != nil {
+			fmt.Println("Error writing config:", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("Error: unknown remote subcommand '%s'\n", args[0])
+		fmt.Println("Usage: fool remote [-v | add <name> <path> | remove <name>]")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// changePlan is the outcome of replaying the difference between two
+// snapshots onto the working directory, computed before anything is written.
+type changePlan struct {
+	results   map[string][]byte
+	removed   []string
+	conflicts []string
+	missing   []string // files the change touches that HEAD does not track
+}
+
+// planChanges works out how to replay the change from snapshot from to
+// snapshot to onto the files tracked at HEAD. A file that is still as the
+// change found it simply takes its new state; otherwise the change's hunks
+// must apply exactly or the file conflicts. Files the change modifies or
+// deletes that HEAD no longer tracks are conflicts unless skipMissing is set,
+// in which case they are listed in missing.
+func planChanges(from, to string, headFiles map[string]bool, skipMissing bool) changePlan {
+	plan := changePlan{results: map[string][]byte{}}
+	paths := snapshotFiles(to)
+	for _, f := range snapshotFiles(from) {
+		if !containsString(paths, f) {
+			paths = append(paths, f)
+		}
+	}
+	for _, f := range paths {
+		before, beforeErr := os.ReadFile(filepath.Join(".fool", "objects", from, f))
+		after, afterErr := os.ReadFile(filepath.Join(".fool", "objects", to, f))
+		inBefore, inAfter := from != "" && beforeErr == nil, to != "" && afterErr == nil
+		if inAfter == inBefore && bytes.Equal(after, before) {
+			continue
+		}
+		current, currentErr := os.ReadFile(f)
+		inCurrent := currentErr == nil && headFiles[f]
+		switch {
+		case inCurrent == inBefore && bytes.Equal(current, before):
+			if inAfter {
+				plan.results[f] = after
+			} else {
+				plan.removed = append(plan.removed, f)
+			}
+		case inCurrent == inAfter && bytes.Equal(current, after):
+			// The change is already there.
+		case !inCurrent && inBefore && skipMissing:
+			plan.missing = append(plan.missing, f)
+		case inCurrent && inBefore && inAfter && !isBinary(current) && !isBinary(before) && !isBinary(after):
+			hunks := buildHunks(diffLines(splitContentLines(before), splitContentLines(after)))
+			if updated, err := applyHunks(current, hunks); err == nil {
+				plan.results[f] = updated
+			} else {
+				plan.conflicts = append(plan.conflicts, f)
+			}
+		default:
+			plan.conflicts = append(plan.conflicts, f)
+		}
+	}
+	return plan
+}
+
+// ensureCleanTree exits unless the index is empty and no tracked file has
+// local modifications, since cmd is about to write files and commit them.
+func ensureCleanTree(cmd string) map[string]bool {
+	if len(readIndex()) > 0 {
+		fmt.Printf("Error: you have staged changes; commit or reset them before running %s.\n", cmd)
+		os.Exit(1)
+	}
+	headFiles, headID := getLastCommitFilesAndID()
+	if modified := modifiedFiles(headFiles, headID); len(modified) > 0 {
+		fmt.Printf("Error: your local changes would be overwritten by %s:\n", cmd)
+		for _, f := range modified {
+			fmt.Println("  ", f)
+		}
+		os.Exit(1)
+	}
+	return headFiles
+}
+
+// applyPlan writes the planned files to the working directory and stages
+// them, ready for cmdCommit.
+func applyPlan(plan changePlan) {
+	var index []string
+	for f, data := range plan.results {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			fmt.Printf("Error writing '%s': %v\n", f, err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(f, data, 0644); err != nil {
+			fmt.Printf("Error writing '%s': %v\n", f, err)
+			os.Exit(1)
+		}
+		index = append(index, f)
+	}
+	for _, f := range plan.removed {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error removing '%s': %v\n", f, err)
+			os.Exit(1)
+		}
+		index = append(index, deleteMarker+f)
+	}
+	if err := writeIndex(index); err != nil {
+		fmt.Println("Error updating index:", err)
+		os.Exit(1)
+	}
+}
+
+func cmdRevert(args []string) {
+	ensureRepo()
+	if len(args) != 1 {
+		fmt.Println("Usage: fool revert <commitID>")
+		return
+	}
+	target, err := resolveRef(args[0])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	commit, err := loadCommit(target)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	headFiles := ensureCleanTree("revert")
+	plan := planChanges(target, commit.Parent, headFiles, false)
+	if len(plan.conflicts) > 0 {
+		fmt.Printf("Error: could not revert %s; these files have changed since:\n", target)
+		for _, f := range plan.conflicts {
+			fmt.Println("  ", f)
+		}
+		os.Exit(1)
+	}
+	if len(plan.results) == 0 && len(plan.removed) == 0 {
+		fmt.Printf("Nothing to revert: %s has no changes.\n", target)
+		return
+	}
+	applyPlan(plan)
+	cmdCommit([]string{"-m", fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.", commit.Subject(), target)})
+}
+
+func cmdCherryPick(args []string) {
+	ensureRepo()
+	if len(args) != 1 {
+		fmt.Println("Usage: fool cherry-pick <commitID>")
+		return
+	}
+	target, err := resolveRef(args[0])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	commit, err := loadCommit(target)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	headFiles := ensureCleanTree("cherry-pick")
+	plan := planChanges(commit.Parent, target, headFiles, true)
+	if len(plan.conflicts) > 0 {
+		fmt.Printf("Error: could not cherry-pick %s; these files conflict:\n", target)
+		for _, f := range plan.conflicts {
+			fmt.Println("  ", f)
+		}
+		os.Exit(1)
+	}
+	for _, f := range plan.missing {
+		fmt.Printf("Warning: '%s' does not exist on this branch, skipping.\n", f)
+	}
+	if len(plan.results) == 0 && len(plan.removed) == 0 {
+		fmt.Printf("Nothing to cherry-pick: the changes of %s are already here.\n", target)
+		return
+	}
+	applyPlan(plan)
+	cmdCommit([]string{"-m", fmt.Sprintf("cherry-picked from %s: %s", target, commit.Message)})
+}
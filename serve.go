@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// commitJSON is the form of a commit returned by /api/commits.
+type commitJSON struct {
+	ID          string    `json:"id"`
+	Parent      string    `json:"parent,omitempty"`
+	MergeParent string    `json:"merge_parent,omitempty"`
+	AuthorName  string    `json:"author_name,omitempty"`
+	AuthorEmail string    `json:"author_email,omitempty"`
+	Date        time.Time `json:"date"`
+	Message     string    `json:"message"`
+	Files       []string  `json:"files"`
+	Deleted     []string  `json:"deleted,omitempty"`
+	Renamed     []string  `json:"renamed,omitempty"`
+}
+
+// infoRefs lists HEAD and every branch and tag as "<id>\t<ref>" lines.
+func infoRefs() string {
+	var b strings.Builder
+	if head := headCommitID(); head != "" {
+		fmt.Fprintf(&b, "%s\tHEAD\n", head)
+	}
+	for _, name := range listRefs("heads") {
+		fmt.Fprintf(&b, "%s\trefs/heads/%s\n", readBranch(name), name)
+	}
+	for _, name := range listRefs("tags") {
+		if data, err := os.ReadFile(tagRefPath(name)); err == nil {
+			fmt.Fprintf(&b, "%s\trefs/tags/%s\n", strings.TrimSpace(string(data)), name)
+		}
+	}
+	return b.String()
+}
+
+// newServeHandler serves the repository in the working directory read-only:
+//
+//	GET /info/refs            HEAD, branches and tags, one "<id>\t<ref>" per line
+//	GET /log                  .fool/log
+//	GET /objects/<id>/<path>  a file of a commit object, such as meta.txt
+//	GET /api/commits          every logged commit as a JSON array, newest first
+func newServeHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info/refs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, infoRefs())
+	})
+	mux.HandleFunc("GET /log", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeFile(w, r, filepath.Join(".fool", "log"))
+	})
+	mux.HandleFunc("GET /objects/{id}/{file...}", func(w http.ResponseWriter, r *http.Request) {
+		id, file := r.PathValue("id"), r.PathValue("file")
+		// Only paths inside a commit object may be served.
+		clean := path.Clean("/" + file)[1:]
+		if strings.ContainsAny(id, `/\`) || id == "." || id == ".." || clean != file || file == "" {
+			http.NotFound(w, r)
+			return
+		}
+		full := filepath.Join(".fool", "objects", id, filepath.FromSlash(file))
+		if info, err := os.Stat(full); err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, full)
+	})
+	mux.HandleFunc("GET /api/commits", func(w http.ResponseWriter, r *http.Request) {
+		ids := logCommitIDs(".fool")
+		commits := []commitJSON{}
+		for i := len(ids) - 1; i >= 0; i-- {
+			c, err := loadCommit(ids[i])
+			if err != nil {
+				continue
+			}
+			commits = append(commits, commitJSON{c.ID, c.Parent, c.MergeParent, c.AuthorName, c.AuthorEmail,
+				c.Date, c.Message, c.Files, c.Deleted, c.Renamed})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(commits)
+	})
+	return mux
+}
+
+func cmdServe(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	port := fs.Int("port", 8080, "TCP port to listen on")
+	fs.Parse(args)
+	addr := fmt.Sprintf(":%d", *port)
+	wd, _ := os.Getwd()
+	fmt.Printf("Serving %s read-only on http://localhost%s/\n", wd, addr)
+	if err := http.ListenAndServe(addr, newServeHandler()); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func stashPath(n int) string {
+	return filepath.Join(".fool", "stash", fmt.Sprintf("stash-%d.patch", n))
+}
+
+// stashNumbers returns the numbers of the saved stashes, oldest first.
+func stashNumbers() []int {
+	entries, _ := os.ReadDir(filepath.Join(".fool", "stash"))
+	var nums []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "stash-") || !strings.HasSuffix(name, ".patch") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "stash-"), ".patch")); err == nil {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// stashHeader returns the value of a "# <key>: " header line in a stash patch.
+func stashHeader(patch, key string) string {
+	for _, line := range splitLines(patch) {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if v, ok := strings.CutPrefix(line, "# "+key+": "); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func cmdStash(args []string) {
+	ensureRepo()
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch sub {
+	case "", "push":
+		stashPush()
+	case "pop":
+		stashPop()
+	case "list":
+		for _, n := range stashNumbers() {
+			data, err := os.ReadFile(stashPath(n))
+			if err != nil {
+				continue
+			}
+			patch := string(data)
+			fmt.Printf("stash@{%d}: %s on %s\n", n, stashHeader(patch, "Date"), stashHeader(patch, "On"))
+		}
+	case "drop":
+		if len(args) != 2 {
+			fmt.Println("Usage: fool stash drop <N>")
+			os.Exit(1)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Printf("Error: invalid stash index '%s'\n", args[1])
+			os.Exit(1)
+		}
+		if err := os.Remove(stashPath(n)); err != nil {
+			fmt.Printf("Error: stash@{%d} not found.\n", n)
+			os.Exit(1)
+		}
+		fmt.Printf("Dropped stash@{%d}\n", n)
+	default:
+		fmt.Printf("Error: unknown stash subcommand '%s'\n", sub)
+		fmt.Println("Usage: fool stash [push | pop | list | drop <N>]")
+		os.Exit(1)
+	}
+}
+
+// stashPush saves the changes to modified and deleted tracked files as a
+// patch against the HEAD commit and restores those files from it.
+func stashPush() {
+	commitFiles, commitID := getLastCommitFilesAndID()
+	modified := modifiedFiles(commitFiles, commitID)
+	deleted := map[string]bool{}
+	for f := range commitFiles {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			deleted[f] = true
+			modified = append(modified, f)
+		}
+	}
+	sort.Strings(modified)
+	if len(modified) == 0 {
+		fmt.Println("No local changes to save.")
+		return
+	}
+	on := currentBranch()
+	if on == "" {
+		on = "detached HEAD"
+	}
+	var patch strings.Builder
+	fmt.Fprintf(&patch, "# Date: %s\n# On: %s %s\n\n", time.Now().Format(time.RFC3339), on, commitID)
+	for _, f := range modified {
+		oldData, _ := os.ReadFile(filepath.Join(".fool", "objects", commitID, f))
+		newData, _ := os.ReadFile(f)
+		if isBinary(oldData) || isBinary(newData) {
+			fmt.Printf("Error: cannot stash binary file '%s'\n", f)
+			os.Exit(1)
+		}
+		diff := unifiedDiff(f, oldData, newData, true, !deleted[f])
+		if diff == "" {
+			// An empty file's deletion has no hunks, only the header.
+			diff = fmt.Sprintf("--- a/%s\n+++ /dev/null\n", filepath.ToSlash(f))
+		}
+		patch.WriteString(diff)
+	}
+	n := 0
+	if nums := stashNumbers(); len(nums) > 0 {
+		n = nums[len(nums)-1] + 1
+	}
+	if err := os.MkdirAll(filepath.Join(".fool", "stash"), 0755); err != nil {
+		fmt.Println("Error saving stash:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(stashPath(n), []byte(patch.String()), 0644); err != nil {
+		fmt.Println("Error saving stash:", err)
+		os.Exit(1)
+	}
+	for _, f := range modified {
+		if err := copyFileToCommit(filepath.Join(".fool", "objects", commitID, f), f); err != nil {
+			fmt.Printf("Error restoring '%s': %v\n", f, err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("Saved working directory changes as stash@{%d} (%d file(s))\n", n, len(modified))
+}
+
+// stashPop applies the most recent stash to the working directory and drops
+// it. Nothing is written unless every file in the patch applies cleanly.
+func stashPop() {
+	nums := stashNumbers()
+	if len(nums) == 0 {
+		fmt.Println("Error: no stash entries.")
+		os.Exit(1)
+	}
+	n := nums[len(nums)-1]
+	data, err := os.ReadFile(stashPath(n))
+	if err != nil {
+		fmt.Println("Error reading stash:", err)
+		os.Exit(1)
+	}
+	patches, err := parsePatch(string(data))
+	if err != nil {
+		fmt.Printf("Error: stash@{%d} is corrupt: %v\n", n, err)
+		os.Exit(1)
+	}
+	results := map[string][]byte{}
+	for _, p := range patches {
+		old, err := os.ReadFile(p.path)
+		if err != nil && p.deleted {
+			fmt.Printf("Error: stash@{%d} deletes '%s', which is missing\n", n, p.path)
+			os.Exit(1)
+		}
+		updated, err := applyHunks(old, p.hunks)
+		if err != nil {
+			fmt.Printf("Error: stash@{%d} does not apply to '%s': %v\n", n, p.path, err)
+			os.Exit(1)
+		}
+		results[p.path] = updated
+	}
+	for _, p := range patches {
+		if p.deleted {
+			if err := os.Remove(p.path); err != nil {
+				fmt.Printf("Error removing '%s': %v\n", p.path, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Deleted '%s'\n", p.path)
+			continue
+		}
+		if err := os.WriteFile(p.path, results[p.path], 0644); err != nil {
+			fmt.Printf("Error writing '%s': %v\n", p.path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Restored changes to '%s'\n", p.path)
+	}
+	os.Remove(stashPath(n))
+	fmt.Printf("Dropped stash@{%d}\n", n)
+}
+
+// filePatch is the part of a unified diff that applies to one file. A
+// deleted file's patch removes all of its lines.
+type filePatch struct {
+	path    string
+	deleted bool
+	hunks   []hunk
+}
+
+// parsePatch reads the unified diffs written by unifiedDiff. Lines before the
+// first "--- " header, such as a stash's own header, are skipped.
+func parsePatch(patch string) ([]filePatch, error) {
+	var patches []filePatch
+	var cur *hunk
+	// oldLeft and newLeft count the lines the current hunk still expects, so
+	// a removed line such as "-- x" is not mistaken for a "--- " header.
+	oldLeft, newLeft := 0, 0
+	oldPath := ""
+	for _, line := range splitLines(patch) {
+		if cur != nil && (oldLeft > 0 || newLeft > 0) {
+			if line == "" || !strings.ContainsRune(" +-", rune(line[0])) {
+				return nil, fmt.Errorf("hunk is shorter than its header says")
+			}
+			if line[0] != '+' {
+				oldLeft--
+			}
+			if line[0] != '-' {
+				newLeft--
+			}
+			cur.ops = append(cur.ops, diffOp{line[0], line[1:]})
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			cur = nil
+			oldPath = strings.TrimPrefix(line, "--- ")
+		case strings.HasPrefix(line, "+++ "):
+			path := strings.TrimPrefix(line, "+++ ")
+			if path == "/dev/null" && strings.HasPrefix(oldPath, "a/") {
+				patches = append(patches, filePatch{path: filepath.FromSlash(oldPath[2:]), deleted: true})
+				continue
+			}
+			if path == "/dev/null" || !strings.HasPrefix(path, "b/") {
+				return nil, fmt.Errorf("unsupported file header %q", line)
+			}
+			patches = append(patches, filePatch{path: filepath.FromSlash(path[2:])})
+		case strings.HasPrefix(line, "@@ "):
+			if len(patches) == 0 {
+				return nil, fmt.Errorf("hunk outside of a file: %q", line)
+			}
+			var h hunk
+			if _, err := fmt.Sscanf(line, "@@ -%d,%d +%d,%d @@", &h.oldStart, &h.oldLines, &h.newStart, &h.newLines); err != nil {
+				return nil, fmt.Errorf("bad hunk header %q", line)
+			}
+			p := &patches[len(patches)-1]
+			p.hunks = append(p.hunks, h)
+			cur = &p.hunks[len(p.hunks)-1]
+			oldLeft, newLeft = h.oldLines, h.newLines
+		case line == "Binary files differ":
+			return nil, fmt.Errorf("binary patches are not supported")
+		}
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, fmt.Errorf("patch ends in the middle of a hunk")
+	}
+	return patches, nil
+}
+
+// applyHunks applies hunks to data, checking that every context and removed
+// line matches. Like the diffs it reads, it works on whole lines, so the
+// result always ends with a newline.
+func applyHunks(data []byte, hunks []hunk) ([]byte, error) {
+	lines := splitContentLines(data)
+	var out []string
+	pos := 0
+	for _, h := range hunks {
+		// An empty old side names the line before the change, see hunkRange.
+		start := h.oldStart - 1
+		if h.oldLines == 0 {
+			start = h.oldStart
+		}
+		if start < pos || start > len(lines) {
+			return nil, fmt.Errorf("hunk at line %d is out of range", h.oldStart)
+		}
+		out = append(out, lines[pos:start]...)
+		at := start
+		for _, op := range h.ops {
+			if op.Kind != '+' {
+				if at >= len(lines) || lines[at] != op.Line {
+					return nil, fmt.Errorf("line %d does not match", at+1)
+				}
+				at++
+			}
+			if op.Kind != '-' {
+				out = append(out, op.Line)
+			}
+		}
+		pos = at
+	}
+	out = append(out, lines[pos:]...)
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type trailer struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// parseTrailers splits msg into its body and the trailer block in its last
+// paragraph. Indented continuation lines are folded into the previous
+// trailer's value. The first paragraph (the subject) is never a trailer block.
+func parseTrailers(msg, sep string) (string, []trailer) {
+	re := regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*)\s*` + regexp.QuoteMeta(sep) + `\s*(.*)$`)
+	lines := splitLines(strings.TrimRight(msg, "\n"))
+	start := len(lines)
+	for start > 0 && strings.TrimSpace(lines[start-1]) != "" {
+		start--
+	}
+	if start == 0 {
+		return strings.Join(lines, "\n"), nil
+	}
+	var trailers []trailer
+	for _, line := range lines[start:] {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(trailers) > 0 {
+			last := &trailers[len(trailers)-1]
+			last.Value = strings.TrimSpace(last.Value + " " + strings.TrimSpace(line))
+			continue
+		}
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			return strings.Join(lines, "\n"), nil
+		}
+		trailers = append(trailers, trailer{Key: m[1], Value: strings.TrimSpace(m[2])})
+	}
+	body := strings.TrimRight(strings.Join(lines[:start], "\n"), "\n")
+	return body, trailers
+}
+
+func cmdInterpretTrailers(args []string) {
+	fs := flag.NewFlagSet("interpret-trailers", flag.ExitOnError)
+	parse := fs.Bool("parse", false, "print only the trailers, one per line")
+	file := fs.String("file", "", "read the message from this file instead of stdin")
+	sep := fs.String("separator", ":", "separator between trailer keys and values")
+	trimEmpty := fs.Bool("trim-empty", false, "skip trailers with empty values")
+	onlyTrailers := fs.Bool("only-trailers", false, "omit the message body from the output")
+	asJSON := fs.Bool("json", false, "print each trailer as a JSON object")
+	fs.Parse(args)
+	if *sep == "" {
+		fmt.Println("Error: separator must not be empty.")
+		os.Exit(1)
+	}
+	var data []byte
+	var err error
+	if *file != "" {
+		data, err = os.ReadFile(*file)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fmt.Println("Error reading message:", err)
+		os.Exit(1)
+	}
+	body, trailers := parseTrailers(string(data), *sep)
+	if *parse {
+		*onlyTrailers = true
+	}
+	if !*onlyTrailers {
+		fmt.Println(body)
+		if len(trailers) > 0 {
+			fmt.Println()
+		}
+	}
+	for _, t := range trailers {
+		if *trimEmpty && t.Value == "" {
+			continue
+		}
+		if *asJSON {
+			line, _ := json.Marshal(t)
+			fmt.Println(string(line))
+			continue
+		}
+		fmt.Printf("%s%s %s\n", t.Key, *sep, t.Value)
+	}
+}
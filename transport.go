@@ -0,0 +1,488 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// remoteURL returns the path of the named remote's repository, checking
+// that it is still a fool repository.
+func remoteURL(name string) (string, error) {
+	url, ok := loadConfig()["remote."+name+".url"]
+	if !ok {
+		return "", fmt.Errorf("no such remote '%s'", name)
+	}
+	if err := validateRemoteURL(url); err != nil {
+		return "", err
+	}
+	return url, nil
+}
+
+// copyObject copies the object directory of commit id from the repository
+// metadata store srcFool to dstFool. meta.txt is copied last, so an
+// interrupted copy never looks like a complete commit.
+func copyObject(srcFool, dstFool, id string) error {
+	src := filepath.Join(srcFool, "objects", id)
+	dst := filepath.Join(dstFool, "objects", id)
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path == filepath.Join(src, "meta.txt") {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		return copyFileToCommit(path, filepath.Join(dst, rel))
+	})
+	if err != nil {
+		return err
+	}
+	return copyFileToCommit(filepath.Join(src, "meta.txt"), filepath.Join(dst, "meta.txt"))
+}
+
+// missingCommits returns, oldest first, the commits of history whose objects
+// the metadata store dstFool does not have.
+func missingCommits(history []*CommitMeta, dstFool string) []*CommitMeta {
+	have := map[string]bool{}
+	entries, _ := os.ReadDir(filepath.Join(dstFool, "objects"))
+	for _, e := range entries {
+		have[e.Name()] = true
+	}
+	var missing []*CommitMeta
+	for i := len(history) - 1; i >= 0; i-- {
+		if !have[history[i].ID] {
+			missing = append(missing, history[i])
+		}
+	}
+	return missing
+}
+
+// appendLogEntries adds commits to the .fool/log of the metadata store
+// dstFool.
+func appendLogEntries(dstFool string, commits []*CommitMeta) error {
+	var b strings.Builder
+	for _, c := range commits {
+		b.WriteString(c.logEntry() + "\n")
+	}
+	f, err := os.OpenFile(filepath.Join(dstFool, "log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(b.String())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// remoteTrackingRefPath is where the last known position of a remote's
+// branch is kept, as in .fool/refs/remotes/origin/main.
+func remoteTrackingRefPath(remote, branch string) string {
+	return filepath.Join(".fool", "refs", "remotes", remote, filepath.FromSlash(branch))
+}
+
+// writeRef points the ref file at path to commitID.
+func writeRef(path, commitID string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(commitID+"\n"))
+}
+
+func cmdPush(args []string) {
+	ensureRepo()
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	var force bool
+	fs.BoolVar(&force, "f", false, "overwrite the remote branch even if it is not an ancestor")
+	fs.BoolVar(&force, "force", false, "overwrite the remote branch even if it is not an ancestor")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fmt.Println("Usage: fool push [--force] <remote> [<branch>]")
+		os.Exit(1)
+	}
+	remote, branch := fs.Arg(0), currentBranch()
+	if fs.NArg() == 2 {
+		branch = fs.Arg(1)
+	}
+	if branch == "" {
+		fmt.Println("Error: HEAD is detached; name the branch to push.")
+		os.Exit(1)
+	}
+	url, err := remoteURL(remote)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	local, ok := branchExists(branch)
+	if !ok || local == "" {
+		fmt.Printf("Error: branch '%s' has no commits to push.\n", branch)
+		os.Exit(1)
+	}
+	remoteFool := filepath.Join(url, ".fool")
+	remoteRef := filepath.Join(remoteFool, "refs", "heads", filepath.FromSlash(branch))
+	old := ""
+	if data, err := os.ReadFile(remoteRef); err == nil {
+		old = strings.TrimSpace(string(data))
+	}
+	if old == local {
+		fmt.Println("Everything up-to-date")
+		return
+	}
+	// The remote tip is only known here if it came from this repository;
+	// anything else means the remote has commits we do not.
+	if ff, _ := isAncestor(old, local); old != "" && !ff && !force {
+		fmt.Printf("Error: push to %s/%s rejected (non-fast-forward).\n", remote, branch)
+		fmt.Println("Pull the remote changes first, or use --force to overwrite them.")
+		os.Exit(1)
+	}
+	missing := missingCommits(commitHistory(local), remoteFool)
+	for _, c := range missing {
+		if err := copyObject(".fool", remoteFool, c.ID); err != nil {
+			fmt.Printf("Error copying commit %s: %v\n", c.ID, err)
+			os.Exit(1)
+		}
+	}
+	if err := appendLogEntries(remoteFool, missing); err != nil {
+		fmt.Println("Error writing the remote log:", err)
+		os.Exit(1)
+	}
+	if err := writeRef(remoteRef, local); err != nil {
+		fmt.Println("Error updating the remote branch:", err)
+		os.Exit(1)
+	}
+	if err := writeRef(remoteTrackingRefPath(remote, branch), local); err != nil {
+		fmt.Println("Warning: could not update the remote-tracking ref:", err)
+	}
+	from := abbrevID(old, defaultAbbrev)
+	if old == "" {
+		from = "(new branch)"
+	}
+	fmt.Printf("Pushed %d commit(s) to %s\n  %s..%s  %s -> %s\n", len(missing), url, from, abbrevID(local, defaultAbbrev), branch, branch)
+}
+
+// logCommitIDs returns the IDs in the .fool/log of the metadata store
+// foolDir, oldest first.
+func logCommitIDs(foolDir string) []string {
+	data, err := os.ReadFile(filepath.Join(foolDir, "log"))
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, entry := range splitLogEntries(string(data)) {
+		if id := logEntryField(entry, "commit "); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// remoteBranches returns the branches of the metadata store foolDir and the
+// commits they point to. A repository from before branch refs has its
+// latest logged commit as main.
+func remoteBranches(foolDir string) map[string]string {
+	branches := map[string]string{}
+	root := filepath.Join(foolDir, "refs", "heads")
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if data, err := os.ReadFile(path); err == nil {
+			rel, _ := filepath.Rel(root, path)
+			branches[filepath.ToSlash(rel)] = strings.TrimSpace(string(data))
+		}
+		return nil
+	})
+	if len(branches) == 0 {
+		if ids := logCommitIDs(foolDir); len(ids) > 0 {
+			branches["main"] = ids[len(ids)-1]
+		}
+	}
+	return branches
+}
+
+// fetchHistory copies the commits reachable from tip in the metadata store
+// remoteFool that are not in have, stopping at commits already here, and
+// returns the IDs it copied. Each object is copied before its parents are
+// read, so they can be looked up locally.
+func fetchHistory(remoteFool, tip string, have map[string]bool) ([]string, error) {
+	var copied []string
+	stack := []string{tip}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == "" || have[id] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(remoteFool, "objects", id, "meta.txt")); err != nil {
+			return copied, fmt.Errorf("the remote is missing commit %s", id)
+		}
+		if err := copyObject(remoteFool, ".fool", id); err != nil {
+			return copied, fmt.Errorf("copying commit %s: %v", id, err)
+		}
+		have[id] = true
+		copied = append(copied, id)
+		c, err := loadCommit(id)
+		if err != nil {
+			return copied, err
+		}
+		stack = append(stack, c.parents()...)
+	}
+	return copied, nil
+}
+
+// fetch copies the commits of the remote's branches that this repository
+// lacks and records where the remote's branches point under refs/remotes. With a
+// branch, only that branch's ref is updated. It returns the fetched tips.
+func fetch(remote, branch string) (map[string]string, error) {
+	url, err := remoteURL(remote)
+	if err != nil {
+		return nil, err
+	}
+	remoteFool := filepath.Join(url, ".fool")
+	branches := remoteBranches(remoteFool)
+	if branch != "" {
+		tip, ok := branches[branch]
+		if !ok {
+			return nil, fmt.Errorf("remote '%s' has no branch '%s'", remote, branch)
+		}
+		branches = map[string]string{branch: tip}
+	}
+	// Fetched commits are logged, so a branch that still relies on the latest
+	// logged commit is pinned before they arrive. Creating refs/heads marks
+	// the repository as using branch refs even if it has no commits yet.
+	if current := currentBranch(); current != "" && readBranch(current) == "" {
+		if head := headCommitID(); head != "" {
+			if err := writeBranch(current, head); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(".fool", "refs", "heads"), 0755); err != nil {
+		return nil, err
+	}
+	have := map[string]bool{}
+	entries, _ := os.ReadDir(filepath.Join(".fool", "objects"))
+	for _, e := range entries {
+		have[e.Name()] = true
+	}
+	var fetched []*CommitMeta
+	if _, err := os.Stat(filepath.Join(remoteFool, "refs", "heads")); err == nil {
+		// Walk each branch from its tip, since amend and reset drop commits
+		// from the log that branches may still point to.
+		names := make([]string, 0, len(branches))
+		for name := range branches {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		copied := map[string]bool{}
+		for _, name := range names {
+			ids, err := fetchHistory(remoteFool, branches[name], have)
+			for _, id := range ids {
+				copied[id] = true
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		// Log what arrived oldest first, in the order of each branch.
+		for _, name := range names {
+			history := commitHistory(branches[name])
+			for i := len(history) - 1; i >= 0; i-- {
+				if id := history[i].ID; copied[id] {
+					delete(copied, id)
+					fetched = append(fetched, history[i])
+				}
+			}
+		}
+	} else {
+		// A remote from before branch refs only knows its commits by its log.
+		for _, id := range logCommitIDs(remoteFool) {
+			if have[id] {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(remoteFool, "objects", id, "meta.txt")); err != nil {
+				continue // logged but since removed from the remote
+			}
+			if err := copyObject(remoteFool, ".fool", id); err != nil {
+				return nil, fmt.Errorf("copying commit %s: %v", id, err)
+			}
+			have[id] = true
+			if c, err := loadCommit(id); err == nil {
+				fetched = append(fetched, c)
+			}
+		}
+	}
+	if err := appendLogEntries(".fool", fetched); err != nil {
+		return nil, err
+	}
+	for name, tip := range branches {
+		if !have[tip] {
+			return nil, fmt.Errorf("remote branch '%s' points to %s, which is not in the remote's log", name, tip)
+		}
+		old := ""
+		if data, err := os.ReadFile(remoteTrackingRefPath(remote, name)); err == nil {
+			old = strings.TrimSpace(string(data))
+		}
+		if old == tip {
+			continue
+		}
+		if err := writeRef(remoteTrackingRefPath(remote, name), tip); err != nil {
+			return nil, err
+		}
+		from := abbrevID(old, defaultAbbrev)
+		if old == "" {
+			from = "(new branch)"
+		}
+		fmt.Printf("  %s..%s  %s -> %s/%s\n", from, abbrevID(tip, defaultAbbrev), name, remote, name)
+	}
+	if len(fetched) > 0 {
+		fmt.Printf("Fetched %d commit(s) from %s\n", len(fetched), url)
+	}
+	return branches, nil
+}
+
+func cmdFetch(args []string) {
+	ensureRepo()
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("Usage: fool fetch <remote> [<branch>]")
+		os.Exit(1)
+	}
+	branch := ""
+	if len(args) == 2 {
+		branch = args[1]
+	}
+	if _, err := fetch(args[0], branch); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+func cmdPull(args []string) {
+	ensureRepo()
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("Usage: fool pull <remote> [<branch>]")
+		os.Exit(1)
+	}
+	remote, branch := args[0], currentBranch()
+	if len(args) == 2 {
+		branch = args[1]
+	}
+	if branch == "" {
+		fmt.Println("Error: HEAD is detached; name the branch to pull.")
+		os.Exit(1)
+	}
+	tips, err := fetch(remote, branch)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	tip, head := tips[branch], headCommitID()
+	if upToDate, _ := isAncestor(tip, head); upToDate {
+		fmt.Println("Already up to date.")
+		return
+	}
+	if ff, _ := isAncestor(head, tip); head != "" && !ff {
+		fmt.Println("Cannot fast-forward; please merge manually")
+		fmt.Printf("The fetched commits are available as %s/%s.\n", remote, branch)
+		os.Exit(1)
+	}
+	cmdMerge([]string{remote + "/" + branch})
+}
+
+// cloneSkip lists what clone leaves out of the source's .fool directory:
+// state that belongs to the source's working copy or its own remotes.
+var cloneSkip = map[string]bool{
+	"index": true, "index.lock": true, "index.tmp": true, "MERGE_HEAD": true,
+	"config": true, "reflog": true, "stash": true, "refs/remotes": true,
+}
+
+func cmdClone(args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: fool clone <source> <destination>")
+		os.Exit(1)
+	}
+	src, dst := args[0], args[1]
+	if err := validateRemoteURL(src); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if entries, err := os.ReadDir(dst); err == nil && len(entries) > 0 {
+		fmt.Printf("Error: destination '%s' already exists and is not empty.\n", dst)
+		os.Exit(1)
+	}
+	// The remote is recorded as an absolute path, since commands run in the
+	// clone, not where it was made from.
+	srcAbs, err := filepath.Abs(src)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	srcFool := filepath.Join(srcAbs, ".fool")
+	fmt.Printf("Cloning into '%s'...\n", dst)
+	dstFool := filepath.Join(dst, ".fool")
+	err = filepath.WalkDir(srcFool, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(srcFool, path)
+		if cloneSkip[filepath.ToSlash(rel)] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dstFool, rel), 0755)
+		}
+		return copyFileToCommit(path, filepath.Join(dstFool, rel))
+	})
+	if err != nil {
+		fmt.Println("Error copying repository:", err)
+		os.Exit(1)
+	}
+
+	// Check out the branch the source has checked out, or main if its HEAD
+	// is detached.
+	branches := remoteBranches(srcFool)
+	branch := "main"
+	if data, err := os.ReadFile(filepath.Join(srcFool, "HEAD")); err == nil {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: refs/heads/"); ok {
+			branch = name
+		}
+	}
+	if err := os.Chdir(dst); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := saveConfig(map[string]string{"remote.origin.url": srcAbs}); err != nil {
+		fmt.Println("Error writing config:", err)
+		os.Exit(1)
+	}
+	for name, tip := range branches {
+		if err := writeRef(remoteTrackingRefPath("origin", name), tip); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(".fool", "HEAD"), []byte("ref: refs/heads/"+branch+"\n"), 0644); err != nil {
+		fmt.Println("Error updating HEAD:", err)
+		os.Exit(1)
+	}
+	tip := branches[branch]
+	if tip == "" {
+		fmt.Println("warning: you appear to have cloned an empty repository.")
+		return
+	}
+	if err := writeBranch(branch, tip); err != nil {
+		fmt.Println("Error updating branch:", err)
+		os.Exit(1)
+	}
+	if _, _, err := restoreSnapshot("", tip); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	appendReflog("", tip, "clone", "from "+srcAbs)
+	fmt.Printf("Checked out branch '%s' at %s\n", branch, abbrevID(tip, defaultAbbrev))
+}